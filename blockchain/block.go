@@ -2,17 +2,72 @@ package blockchain
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/gob"
 	"time"
 )
 
+// the header is everything proof-of-work commits to — changing any of its fields invalidates the block's hash
+type BlockHeader struct {
+	Version    int    // carries the bits signalling deployments, see versionbits.go
+	PrevHash   []byte // linked list functionality (chain)
+	MerkleRoot []byte // root of the merkle tree built from the block's transactions
+	Timestamp  int64
+	Bits       uint32 // compact representation of the target the block's hash must meet
+	Nonce      uint64
+	Height     int
+	Signer     []byte // public key of the authority that sealed the block, for proof-of-authority
+	Signature  []byte // the signer's signature of the header's seal hash, for proof-of-authority
+}
+
 type Block struct {
-	Timestamp    int64
-	Hash         []byte         // a hash of the Data + PrevHash
+	BlockHeader
+	Hash         []byte         // a hash of the block's header
 	Transactions []*Transaction // the data of a block
-	PrevHash     []byte         // linked list functionality (chain)
-	Nonce        int
-	Height       int
+}
+
+// the header's canonical byte representation, which is what gets hashed
+func (h *BlockHeader) Serialize() []byte {
+	return append(h.sealData(), h.Signature...)
+}
+
+// everything in the header but the signature, which can't sign itself
+// the nonce is followed by the 8 byte height and the signer, which proof-of-work leaves empty
+func (h *BlockHeader) sealData() []byte {
+	return bytes.Join(
+		[][]byte{
+			toHex(int64(h.Version)),
+			h.PrevHash,
+			h.MerkleRoot,
+			toHex(h.Timestamp),
+			toHex(int64(h.Bits)),
+			toHex(int64(h.Nonce)),
+			toHex(int64(h.Height)),
+			h.Signer,
+		},
+		[]byte{},
+	)
+}
+
+// where the 8 byte nonce starts in the serialized header, after the version, previous hash, merkle root, timestamp and bits
+// keep in step with sealData
+func (h *BlockHeader) nonceOffset() int {
+	return 8 + len(h.PrevHash) + len(h.MerkleRoot) + 8 + 8
+}
+
+// the hash identifying the block this header belongs to
+func (h *BlockHeader) Hash() []byte {
+	hash := sha256.Sum256(h.Serialize())
+
+	return hash[:]
+}
+
+// the hash an authority signs to seal the block
+func (h *BlockHeader) SealHash() []byte {
+	hash := sha256.Sum256(h.sealData())
+
+	return hash[:]
 }
 
 // helper function to hash the blocks' transactions
@@ -27,21 +82,33 @@ func (b *Block) HashTransactions() []byte {
 	return tree.RootNode.Data
 }
 
-// create a new instance of block with the given parameters
-func createBlock(transactions []*Transaction, prevHash []byte, height int) *Block {
-	block := &Block{time.Now().Unix(), []byte{}, transactions, prevHash, 0, height}
-	pow := NewProof(block) // proove block's creation
-	nonce, hash := pow.Run()
+// create a new instance of block with the given parameters, sealed by the chain's consensus engine
+// sealing is abandoned, and the context's error returned, once ctx is cancelled
+func (chain *BlockChain) createBlock(ctx context.Context, transactions []*Transaction, prevHash []byte, height int, timestamp int64) (*Block, error) {
+	version, err := chain.CalcNextBlockVersion(prevHash)
+	if err != nil {
+		return nil, err
+	}
 
-	block.Hash = hash[:]
-	block.Nonce = nonce
+	header := BlockHeader{Version: version, PrevHash: prevHash, Timestamp: timestamp, Height: height}
+	if err := chain.Engine.Prepare(chain, &header); err != nil {
+		return nil, err
+	}
+
+	block := &Block{header, []byte{}, transactions}
+	block.MerkleRoot = block.HashTransactions()
+
+	// proove block's creation
+	if err := chain.Engine.Seal(ctx, chain, block); err != nil {
+		return nil, err
+	}
 
-	return block
+	return block, nil
 }
 
 // create a genesis block exists — without it, the first "real" block would now have a previous block hash to reference
-func genesis(coinbase *Transaction) *Block {
-	return createBlock([]*Transaction{coinbase}, []byte{}, 0)
+func (chain *BlockChain) genesis(coinbase *Transaction) (*Block, error) {
+	return chain.createBlock(context.Background(), []*Transaction{coinbase}, []byte{}, 0, time.Now().Unix())
 }
 
 // GO's BadgerDB requires byte slices, so a Serialize() needs to exist
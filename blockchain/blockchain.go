@@ -2,28 +2,48 @@ package blockchain
 
 import (
 	"bytes"
+	"context"
 	"crypto/ecdsa"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"golang-blockchain/params"
+	"golang-blockchain/wallet"
 	"log"
 	"os"
 	"path/filepath"
 	"runtime"
 	"slices"
 	"strings"
+	"sync"
 
 	"github.com/dgraph-io/badger"
 )
 
-const (
-	dbPath      = "./tmp/blocks_%s"
-	genesisData = "First Transaction from genesis"
+const dbPath = "./tmp/blocks_%s"
+
+// the keys the parameters and the consensus engine a chain was created with are stored under
+var (
+	paramsKey    = []byte("params")
+	consensusKey = []byte("consensus")
 )
 
 type BlockChain struct {
 	LastHash []byte
 	Database *badger.DB
+	Params   *params.ChainParams // the parameters of the network the chain belongs to
+	Engine   ConsensusEngine     // decides how blocks are sealed and verified
+	Hashrate HashrateFunc        // optional callback receiving the miner's hashrate while a block is being mined
+	Clock    Clock               // the time the timestamp rules are checked against, the system's clock if nil
+
+	// skip verifying the signatures of transactions in the last checkpoint's block and the blocks known to lead up to it
+	SkipCheckpointedSignatures bool
+
+	mutex        sync.Mutex         // serializes changes to the chain's tip
+	orphans      orphanPool         // blocks waiting for their parent to arrive
+	checkpointed checkpointAncestry // blocks known to lead up to the last checkpoint
+	deployments  thresholdCache     // the states of the chain's deployments, by window
 }
 
 // helper function to check if MANIFEST file exists, i.e., the DB
@@ -35,6 +55,8 @@ func DBexists(path string) bool {
 }
 
 // fetch existing blockchain and continue the chain
+// the chain keeps the parameters it was created with, which have to belong to the active network,
+// and the consensus engine it was created with
 func ContinueBlockChain(nodeId string) *BlockChain {
 	path := fmt.Sprintf(dbPath, nodeId)
 	if !DBexists(path) {
@@ -43,6 +65,8 @@ func ContinueBlockChain(nodeId string) *BlockChain {
 	}
 
 	var lastHash []byte
+	var chainParams params.ChainParams
+	var consensus ConsensusConfig
 
 	opts := badger.DefaultOptions(path)
 	opts.ValueDir = path
@@ -59,19 +83,56 @@ func ContinueBlockChain(nodeId string) *BlockChain {
 			lastHash = slices.Clone(v)
 			return nil
 		})
+		Handle(err)
 
-		return err
+		// chains created before there were several networks belong to mainnet
+		item, err = txn.Get(paramsKey)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			chainParams = params.MainNet
+		} else {
+			Handle(err)
+
+			err = item.Value(func(v []byte) error {
+				return json.Unmarshal(v, &chainParams)
+			})
+			Handle(err)
+		}
+
+		// chains created before consensus engines were pluggable run proof-of-work
+		item, err = txn.Get(consensusKey)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		}
+		Handle(err)
+
+		return item.Value(func(v []byte) error {
+			return json.Unmarshal(v, &consensus)
+		})
 	})
 
 	Handle(err)
 
-	chain := BlockChain{lastHash, db}
+	if chainParams.Name != params.Active.Name {
+		fmt.Printf("Blockchain belongs to %s, but the node is running on %s\n", chainParams.Name, params.Active.Name)
+		db.Close()
+		runtime.Goexit()
+	}
+
+	// checkpoints only get added as the chain grows, so they're taken from the running node rather than the stored parameters
+	chainParams.Checkpoints = params.Active.Checkpoints
+
+	engine, err := consensus.NewEngine()
+	Handle(err)
+
+	chain := BlockChain{LastHash: lastHash, Database: db, Params: &chainParams, Engine: engine}
 
 	return &chain
 }
 
 // create a new instance of a blockchain with a genesis block and transaction
-func CreateBlockChain(address, nodeId string) *BlockChain {
+// the chain is created for the active network, whose parameters are stored alongside it, and runs the given consensus engine
+// engines sealing blocks with a key seal the genesis block with the signer's, which may be nil otherwise
+func CreateBlockChain(address, nodeId string, consensus ConsensusConfig, signer *wallet.Wallet) *BlockChain {
 	path := fmt.Sprintf(dbPath, nodeId)
 	if DBexists(path) {
 		fmt.Println("Blockchain already exists")
@@ -80,19 +141,46 @@ func CreateBlockChain(address, nodeId string) *BlockChain {
 
 	var lastHash []byte
 
+	engine, err := consensus.NewEngine()
+	Handle(err)
+
+	if authorizer, ok := engine.(Authorizer); ok {
+		if signer == nil {
+			log.Panic("A signer is needed to seal the genesis block")
+		}
+		Handle(authorizer.Authorize(signer))
+	}
+
 	opts := badger.DefaultOptions(path)
 	opts.ValueDir = path
 	db, err := openDB(path, opts)
 	Handle(err)
 
+	blockChain := BlockChain{Database: db, Params: params.Active, Engine: engine}
+
 	// set blockchains' last hash pointer
 	err = db.Update(func(txn *badger.Txn) error {
-		coinbaseTransaction := CoinbaseTx(address, genesisData)
-		genesisBlock := genesis(coinbaseTransaction)
+		chainParams, err := json.Marshal(blockChain.Params)
+		Handle(err)
+		err = txn.Set(paramsKey, chainParams)
+		Handle(err)
+
+		consensusConfig, err := json.Marshal(consensus)
+		Handle(err)
+		err = txn.Set(consensusKey, consensusConfig)
+		Handle(err)
+
+		coinbaseTransaction := CoinbaseTx(address, blockChain.Params.GenesisData, blockChain.Params.BlockSubsidy(0))
+		genesisBlock, err := blockChain.genesis(coinbaseTransaction)
+		Handle(err)
 		fmt.Println("Genesis block created")
 
 		err = txn.Set(genesisBlock.Hash, genesisBlock.Serialize())
 		Handle(err)
+		err = txn.Set(workKey(genesisBlock.Hash), engine.Work(&genesisBlock.BlockHeader).Bytes())
+		Handle(err)
+		err = blockChain.connectBlock(txn, genesisBlock)
+		Handle(err)
 		err = txn.Set([]byte("lh"), genesisBlock.Hash)
 
 		lastHash = genesisBlock.Hash
@@ -102,7 +190,7 @@ func CreateBlockChain(address, nodeId string) *BlockChain {
 
 	Handle(err)
 
-	blockChain := BlockChain{lastHash, db}
+	blockChain.LastHash = lastHash
 
 	return &blockChain
 }
@@ -157,97 +245,27 @@ func (chain *BlockChain) GetBestHeight() int {
 	return lastBlock.Height
 }
 
+// ErrStaleTip is returned when another block became the chain's tip while a block was being mined on top of the old one
+var ErrStaleTip = errors.New("chain tip changed while mining")
+
 // create and append a new bock to the list of existing blocks
 func (chain *BlockChain) MineBlock(transactions []*Transaction) *Block {
-	var lastHash []byte
-	var lastHeight int
-
-	// fetch blockchains' last hash pointer
-	err := chain.Database.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte("lh"))
-		Handle(err)
-
-		err = item.Value(func(v []byte) error {
-			// this func with val would only be called if item.Value() encounters no error.
-			lastHash = slices.Clone(v)
-			return nil
-		})
-
-		item, err = txn.Get(lastHash)
-
-		var lastBlockData []byte
-		err = item.Value(func(v []byte) error {
-			// this func with val would only be called if item.Value() encounters no error.
-			lastBlockData = slices.Clone(v)
-			return nil
-		})
-
-		lastBlock := Deserialize(lastBlockData)
-
-		lastHeight = lastBlock.Height
-
-		return err
-	})
-
-	newBlock := createBlock(transactions, lastHash, lastHeight+1)
-	fmt.Println("lastheight is", lastHeight+1)
-
-	// set blockchains' last hash pointer
-	err = chain.Database.Update(func(txn *badger.Txn) error {
-		err = txn.Set(newBlock.Hash, newBlock.Serialize())
-		Handle(err)
-		err = txn.Set([]byte("lh"), newBlock.Hash)
-
-		chain.LastHash = newBlock.Hash
-
-		return err
-	})
-
+	block, err := chain.MineBlockContext(context.Background(), transactions)
 	Handle(err)
 
-	return newBlock
+	return block
 }
 
-func (chain *BlockChain) AddBlock(block *Block) {
-	err := chain.Database.Update(func(txn *badger.Txn) error {
-		if _, err := txn.Get(block.Hash); err != nil {
-			return nil
-		}
-
-		blockData := block.Serialize()
-		err := txn.Set(block.Hash, blockData)
-		Handle(err)
-
-		item, err := txn.Get([]byte("lh"))
-		Handle(err)
-
-		var lastHash []byte
-		err = item.Value(func(v []byte) error {
-			// this func with val would only be called if item.Value() encounters no error.
-			lastHash = slices.Clone(v)
-			return nil
-		})
-
-		item, err = txn.Get(lastHash)
-
-		var lastBlockData []byte
-		err = item.Value(func(v []byte) error {
-			// this func with val would only be called if item.Value() encounters no error.
-			lastBlockData = slices.Clone(v)
-			return nil
-		})
-
-		lastBlock := Deserialize(lastBlockData)
+// same as MineBlock, but mining stops, returning the context's error, as soon as ctx is cancelled
+func (chain *BlockChain) MineBlockContext(ctx context.Context, transactions []*Transaction) (*Block, error) {
+	template, err := chain.NewBlockTemplate(nil)
+	if err != nil {
+		return nil, err
+	}
 
-		if block.Height > lastBlock.Height {
-			err = txn.Set([]byte("lh"), block.Hash)
-			Handle(err)
-			chain.LastHash = block.Hash
-		}
+	fmt.Println("lastheight is", template.Height)
 
-		return nil
-	})
-	Handle(err)
+	return chain.SealBlock(ctx, template.newBlock(transactions))
 }
 
 func (chain *BlockChain) GetBlock(blockHash []byte) (Block, error) {
@@ -294,6 +312,11 @@ func (chain *BlockChain) FindUnspentTransactions() map[string]TransactionOutputs
 
 		Outputs:
 			for outIdx, out := range tx.Outputs {
+				// data outputs can't be spent, so they are never part of the UTXO set
+				if out.ScriptPubKey.IsUnspendable() {
+					continue
+				}
+
 				// if the output that has been spent, skip to the next iteration
 				// and dont add it to the unspent transactions slice
 				if spentTXOs[txID] != nil {
@@ -305,7 +328,10 @@ func (chain *BlockChain) FindUnspentTransactions() map[string]TransactionOutputs
 				}
 
 				outs := UTXO[txID]
-				outs.Outputs = append(outs.Outputs, out)
+				if outs.Outputs == nil {
+					outs = TransactionOutputs{make(map[int]TransactionOutput), block.Height, tx.isCoinbase()}
+				}
+				outs.Outputs[outIdx] = out
 				UTXO[txID] = outs
 			}
 
@@ -0,0 +1,205 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"golang-blockchain/params"
+	"golang-blockchain/wallet"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger"
+)
+
+// a clock that only moves when told to, so the timestamp rules can be tested deterministically
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+// create a fresh chain with the given parameters in a temporary directory, paying the genesis reward to a new wallet
+// the chain's blocks are timestamped with the clock's time
+func newTestChain(t *testing.T, chainParams params.ChainParams, clock Clock) (*BlockChain, *wallet.Wallet) {
+	t.Helper()
+
+	active := params.Active
+	params.Active = &chainParams
+	t.Cleanup(func() { params.Active = active })
+
+	// the database lives under ./tmp, relative to the working directory
+	t.Chdir(t.TempDir())
+	if err := os.Mkdir("tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	w := wallet.MakeWallet()
+	chain := CreateBlockChain(string(w.Address()), "test", ConsensusConfig{}, nil)
+	chain.Clock = clock
+	t.Cleanup(func() { chain.Database.Close() })
+
+	return chain, w
+}
+
+// the code of the rule the error broke, failing the test if it isn't a RuleError
+func ruleErrorCode(t *testing.T, err error) ErrorCode {
+	t.Helper()
+
+	var ruleErr RuleError
+	if !errors.As(err, &ruleErr) {
+		t.Fatalf("expected a RuleError, got %v", err)
+	}
+
+	return ruleErr.ErrorCode
+}
+
+// the block at the chain's tip
+func tipBlock(t *testing.T, chain *BlockChain) *Block {
+	t.Helper()
+
+	block, err := chain.GetBlock(chain.LastHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &block
+}
+
+// a coinbase claiming the subsidy of the block at the given height for a new wallet
+func newCoinbase(chain *BlockChain, height int) *Transaction {
+	return CoinbaseTx(string(wallet.MakeWallet().Address()), "", chain.Params.BlockSubsidy(height))
+}
+
+// seal a block made of the transactions on top of parent, without adding it to the chain
+// the parent doesn't have to be known, as the regtest chains the tests run on don't retarget
+func buildBlock(t *testing.T, chain *BlockChain, parent *Block, txs ...*Transaction) *Block {
+	t.Helper()
+
+	header := BlockHeader{
+		Version:   VersionBitsTopBits,
+		PrevHash:  parent.Hash,
+		Timestamp: parent.Timestamp + 1,
+		Bits:      BigToCompact(chain.PowLimit()),
+		Height:    parent.Height + 1,
+	}
+
+	block := &Block{header, []byte{}, txs}
+	reseal(t, chain, block)
+
+	return block
+}
+
+// seal the block again after its header or transactions changed
+func reseal(t *testing.T, chain *BlockChain, block *Block) {
+	t.Helper()
+
+	block.MerkleRoot = block.HashTransactions()
+	block.Nonce = 0
+
+	if err := chain.Engine.Seal(t.Context(), chain, block); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// seal n blocks holding nothing but a coinbase on top of parent, returning them oldest first
+func buildBranch(t *testing.T, chain *BlockChain, parent *Block, n int) []*Block {
+	t.Helper()
+
+	var blocks []*Block
+	for range n {
+		parent = buildBlock(t, chain, parent, newCoinbase(chain, parent.Height+1))
+		blocks = append(blocks, parent)
+	}
+
+	return blocks
+}
+
+// check the UTXO set holds exactly the outputs the chain's blocks, from its tip back, left unspent
+func checkUTXOSet(t *testing.T, chain *BlockChain) {
+	t.Helper()
+
+	utxos := make(map[string]TransactionOutputs)
+	err := chain.Database.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Seek(UTXOPrefix); it.ValidForPrefix(UTXOPrefix); it.Next() {
+			value, err := it.Item().ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			utxos[hex.EncodeToString(bytes.TrimPrefix(it.Item().Key(), UTXOPrefix))] = DeserializeOutputs(value)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := chain.FindUnspentTransactions(); !reflect.DeepEqual(utxos, expected) {
+		t.Errorf("UTXO set holds %d transactions' outputs, the chain leaves %d unspent", len(utxos), len(expected))
+	}
+}
+
+// sign the transaction again with the wallet's key after its inputs or outputs changed
+func resign(chain *BlockChain, w *wallet.Wallet, tx *Transaction) {
+	for i := range tx.Inputs {
+		tx.Inputs[i].ScriptSig = nil
+	}
+
+	tx.ID = tx.hash()
+	chain.SignTransaction(tx, w.PrivateKey)
+}
+
+// add a block holding the transactions on top of the chain's tip, failing the test if it's rejected
+func mineTransactions(t *testing.T, chain *BlockChain, txs ...*Transaction) *Block {
+	t.Helper()
+
+	tip := tipBlock(t, chain)
+	block := buildBlock(t, chain, tip, append([]*Transaction{newCoinbase(chain, tip.Height+1)}, txs...)...)
+	addBlocks(t, chain, block)
+	checkTip(t, chain, block)
+
+	return block
+}
+
+// check a block holding the transactions on top of the chain's tip is rejected for breaking the rule, leaving the tip alone
+func rejectTransactions(t *testing.T, chain *BlockChain, code ErrorCode, txs ...*Transaction) {
+	t.Helper()
+
+	tip := tipBlock(t, chain)
+	block := buildBlock(t, chain, tip, append([]*Transaction{newCoinbase(chain, tip.Height+1)}, txs...)...)
+	if got := ruleErrorCode(t, chain.AddBlock(block)); got != code {
+		t.Fatalf("expected %s, got %s", code, got)
+	}
+	checkTip(t, chain, tip)
+}
+
+func TestContinueChainWithoutParams(t *testing.T) {
+	chain, _ := newTestChain(t, params.MainNet, &fakeClock{time.Now()})
+
+	// chains created before the parameters were stored only have the blocks
+	err := chain.Database.Update(func(txn *badger.Txn) error {
+		return txn.Delete(paramsKey)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.Database.Close()
+
+	continued := ContinueBlockChain("test")
+	chain.Database = continued.Database
+
+	if continued.Params.Name != params.MainNet.Name {
+		t.Errorf("expected the chain to belong to %s, got %s", params.MainNet.Name, continued.Params.Name)
+	}
+	if !bytes.Equal(continued.LastHash, chain.LastHash) {
+		t.Errorf("expected the chain to continue from %x, got %x", chain.LastHash, continued.LastHash)
+	}
+}
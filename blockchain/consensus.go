@@ -0,0 +1,173 @@
+package blockchain
+
+import (
+	"context"
+	"fmt"
+	"golang-blockchain/params"
+	"golang-blockchain/wallet"
+	"math/big"
+)
+
+// a consensus engine decides who may create blocks and how their headers prove it
+type ConsensusEngine interface {
+	// fill in the consensus fields of a new block's header, such as its target
+	Prepare(chain *BlockChain, header *BlockHeader) error
+
+	// make the block valid, setting its final header and hash
+	// sealing is abandoned, and the context's error returned, once ctx is cancelled
+	Seal(ctx context.Context, chain *BlockChain, block *Block) error
+
+	// check that the header follows the engine's rules, returning a RuleError if it doesn't
+	VerifyHeader(chain *BlockChain, header *BlockHeader) error
+
+	// check the header's seal on its own, for blocks whose parent isn't known yet, returning a RuleError if it's invalid
+	// unlike VerifyHeader, proof-of-work is checked against the target the header claims rather than the one the chain expects
+	VerifySeal(chain *BlockChain, header *BlockHeader) error
+
+	// how much the block adds to its branch's weight when picking the best chain
+	Work(header *BlockHeader) *big.Int
+}
+
+// engines sealing blocks with a private key rather than with work
+type Authorizer interface {
+	// use the wallet's key to seal blocks, failing if the key isn't allowed to
+	Authorize(w *wallet.Wallet) error
+}
+
+const (
+	EnginePow    = "pow"    // SHA-256 proof-of-work
+	EngineScrypt = "scrypt" // memory-hard scrypt proof-of-work
+	EnginePoa    = "poa"    // proof-of-authority
+)
+
+// which consensus engine a chain runs, stored alongside the chain when it is created
+type ConsensusConfig struct {
+	Engine  string   `json:"engine"`
+	Signers [][]byte `json:"signers,omitempty"` // public key hashes allowed to seal blocks, for proof-of-authority
+}
+
+// build the engine the config describes
+func (config ConsensusConfig) NewEngine() (ConsensusEngine, error) {
+	switch config.Engine {
+	case "", EnginePow:
+		return PowEngine{}, nil
+	case EngineScrypt:
+		return ScryptEngine{}, nil
+	case EnginePoa:
+		if len(config.Signers) == 0 {
+			return nil, fmt.Errorf("proof-of-authority needs at least one signer")
+		}
+		return &PoaEngine{Signers: config.Signers}, nil
+	}
+
+	return nil, fmt.Errorf("unknown consensus engine %q", config.Engine)
+}
+
+// the SHA-256 proof-of-work engine: blocks are sealed by finding a nonce whose header hash meets the target
+type PowEngine struct{}
+
+func (PowEngine) Prepare(chain *BlockChain, header *BlockHeader) error {
+	bits, err := chain.CalcNextBits(header.PrevHash)
+	if err != nil {
+		return err
+	}
+	header.Bits = bits
+
+	return nil
+}
+
+func (PowEngine) Seal(ctx context.Context, chain *BlockChain, block *Block) error {
+	return NewProof(block).Run(ctx, chain.Hashrate)
+}
+
+func (PowEngine) VerifyHeader(chain *BlockChain, header *BlockHeader) error {
+	return verifyProofOfWork(chain, header, SHA256Hash)
+}
+
+func (PowEngine) VerifySeal(chain *BlockChain, header *BlockHeader) error {
+	return verifySeal(chain, header, SHA256Hash)
+}
+
+func (PowEngine) Work(header *BlockHeader) *big.Int {
+	return CalcWork(header.Bits)
+}
+
+func (PowEngine) PowLimit(p *params.ChainParams) *big.Int {
+	return PowLimit(p)
+}
+
+// the scrypt proof-of-work engine: the same as PowEngine, but the hash meeting the target is a memory-hard scrypt hash
+// it has its own, easier, pow limit, as scrypt hashes are thousands of times slower to compute than SHA-256 ones
+type ScryptEngine struct {
+	PowEngine
+}
+
+func (ScryptEngine) Seal(ctx context.Context, chain *BlockChain, block *Block) error {
+	return NewProofWithHash(block, ScryptHash).Run(ctx, chain.Hashrate)
+}
+
+func (ScryptEngine) VerifyHeader(chain *BlockChain, header *BlockHeader) error {
+	return verifyProofOfWork(chain, header, ScryptHash)
+}
+
+func (ScryptEngine) VerifySeal(chain *BlockChain, header *BlockHeader) error {
+	return verifySeal(chain, header, ScryptHash)
+}
+
+func (ScryptEngine) PowLimit(p *params.ChainParams) *big.Int {
+	return ScryptPowLimit(p)
+}
+
+// check that the header carries the target the chain expects, and that its hash, computed with the given function, meets it
+func verifyProofOfWork(chain *BlockChain, header *BlockHeader, powHash PowHash) error {
+	hash := header.Hash()
+
+	if err := checkUnsigned(header); err != nil {
+		return err
+	}
+
+	expectedBits, err := chain.CalcNextBits(header.PrevHash)
+	if err != nil {
+		return ruleError(ErrMissingParent, "parent %x of block %x is unknown", header.PrevHash, hash)
+	}
+
+	if header.Bits != expectedBits {
+		return ruleError(ErrBadTarget, "block %x has target bits %08x, expected %08x", hash, header.Bits, expectedBits)
+	}
+
+	block := &Block{BlockHeader: *header, Hash: hash}
+	if !NewProofWithHash(block, powHash).Validate(chain) {
+		return ruleError(ErrBadProofOfWork, "block %x's hash doesn't meet its target", hash)
+	}
+
+	return nil
+}
+
+// check that the header's target is within the chain's limit, and that its hash, computed with the given function, meets it
+func verifySeal(chain *BlockChain, header *BlockHeader, powHash PowHash) error {
+	hash := header.Hash()
+
+	if err := checkUnsigned(header); err != nil {
+		return err
+	}
+
+	target := CompactToBig(header.Bits)
+	if target.Sign() <= 0 || target.Cmp(chain.PowLimit()) > 0 {
+		return ruleError(ErrBadTarget, "block %x has target bits %08x, outside the chain's limit", hash, header.Bits)
+	}
+
+	if new(big.Int).SetBytes(powHash.Sum(header.Serialize())).Cmp(target) >= 0 {
+		return ruleError(ErrBadProofOfWork, "block %x's hash doesn't meet its target", hash)
+	}
+
+	return nil
+}
+
+// proof-of-work blocks aren't signed, so a signer or signature would only be junk carried along in the header
+func checkUnsigned(header *BlockHeader) error {
+	if len(header.Signer) != 0 || len(header.Signature) != 0 {
+		return ruleError(ErrBadBlockSignature, "proof-of-work block %x carries a signer or signature", header.Hash())
+	}
+
+	return nil
+}
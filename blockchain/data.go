@@ -0,0 +1,49 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"golang-blockchain/wallet"
+)
+
+// create a new transaction anchoring the data on the chain in a data output, paying the fee from the wallet
+func NewDataTransaction(w *wallet.Wallet, data []byte, fee int, UTXO *UTXOSet) (*Transaction, error) {
+	if limit := UTXO.Blockchain.Params.MaxDataCarrierSize; len(data) > limit {
+		return nil, fmt.Errorf("can't carry %d bytes of data, the chain allows %d", len(data), limit)
+	}
+
+	return newTransaction(w, []TransactionOutput{{0, DataScript(data)}}, fee, UTXO), nil
+}
+
+// look through the chain for the earliest data output carrying the data, returning the block and transaction holding it
+// there's no index of data outputs, so every lookup walks the whole chain from the tip back to genesis,
+// keeping the last match it comes across
+func (chain *BlockChain) FindData(data []byte) (*Block, *Transaction, error) {
+	var found *Block
+	var foundTx *Transaction
+
+	iter := chain.Iterator()
+
+	for {
+		block := iter.Next()
+
+		for _, tx := range block.Transactions {
+			for _, out := range tx.Outputs {
+				if carried, ok := out.ScriptPubKey.Data(); ok && bytes.Equal(carried, data) {
+					found, foundTx = block, tx
+				}
+			}
+		}
+
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+
+	if found == nil {
+		return nil, nil, errors.New("no data output carries the data")
+	}
+
+	return found, foundTx, nil
+}
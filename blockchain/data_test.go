@@ -0,0 +1,86 @@
+package blockchain
+
+import (
+	"bytes"
+	"golang-blockchain/params"
+	"golang-blockchain/wallet"
+	"testing"
+	"time"
+)
+
+// a chain on regtest whose genesis reward has matured, so the wallet has something to pay for transactions with
+func newFundedTestChain(t *testing.T) (*BlockChain, *wallet.Wallet) {
+	t.Helper()
+
+	chain, w := newTestChain(t, params.RegTest, &fakeClock{time.Now()})
+	if _, err := chain.GenerateBlocks(chain.Params.CoinbaseMaturity, string(wallet.MakeWallet().Address())); err != nil {
+		t.Fatal(err)
+	}
+
+	return chain, w
+}
+
+// mine the data transaction in a block of its own, returning the block
+func mineDataTransaction(t *testing.T, chain *BlockChain, w *wallet.Wallet, data []byte, fee int) *Block {
+	t.Helper()
+
+	tx, err := NewDataTransaction(w, data, fee, &UTXOSet{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	coinbase := CoinbaseTx(string(w.Address()), "", chain.Params.BlockSubsidy(chain.GetBestHeight()+1)+fee)
+	block, err := chain.MineBlockContext(t.Context(), []*Transaction{coinbase, tx})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return block
+}
+
+func TestZeroFeeDataTransaction(t *testing.T) {
+	chain, w := newFundedTestChain(t)
+	data := []byte("anchored for free")
+
+	tx, err := NewDataTransaction(w, data, 0, &UTXOSet{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tx.Inputs) == 0 {
+		t.Fatal("a data transaction without a fee has no input")
+	}
+
+	block := mineDataTransaction(t, chain, w, data, 0)
+
+	found, _, err := chain.FindData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(found.Hash, block.Hash) {
+		t.Errorf("data found in block %x, expected %x", found.Hash, block.Hash)
+	}
+}
+
+func TestFindDataAnchoredTwice(t *testing.T) {
+	chain, w := newFundedTestChain(t)
+	data := []byte("anchored twice")
+
+	first := mineDataTransaction(t, chain, w, data, 1)
+	mineDataTransaction(t, chain, w, data, 1)
+
+	found, tx, err := chain.FindData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(found.Hash, first.Hash) {
+		t.Errorf("data found in block %x, expected the earlier %x", found.Hash, first.Hash)
+	}
+	if !bytes.Equal(tx.ID, first.Transactions[1].ID) {
+		t.Errorf("data found in transaction %x, expected %x", tx.ID, first.Transactions[1].ID)
+	}
+
+	if _, _, err := chain.FindData([]byte("never anchored")); err == nil {
+		t.Error("found data that was never anchored")
+	}
+}
@@ -0,0 +1,133 @@
+package blockchain
+
+import (
+	"golang-blockchain/params"
+	"math/big"
+)
+
+// the difficulty is retargeted every RetargetInterval blocks so that, on average,
+// a new block is found every TargetSpacing seconds no matter how many miners are online
+
+// the easiest target SHA-256 proof-of-work accepts — every block's target must be at or below it
+func PowLimit(p *params.ChainParams) *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(256-p.Difficulty))
+}
+
+// the easiest target scrypt proof-of-work accepts, which is lower as every scrypt hash takes far longer
+func ScryptPowLimit(p *params.ChainParams) *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(256-p.ScryptDifficulty))
+}
+
+// engines whose blocks carry a target, each with the easiest one it accepts
+type TargetEngine interface {
+	PowLimit(p *params.ChainParams) *big.Int
+}
+
+// the easiest target the chain's engine accepts, used by the genesis block and the first retarget window
+func (chain *BlockChain) PowLimit() *big.Int {
+	if engine, ok := chain.Engine.(TargetEngine); ok {
+		return engine.PowLimit(chain.Params)
+	}
+
+	return PowLimit(chain.Params)
+}
+
+// convert a compact "bits" representation into the full 256 bit target
+// the compact form stores a 3 byte mantissa and a 1 byte exponent (the size of the number in bytes)
+func CompactToBig(compact uint32) *big.Int {
+	mantissa := compact & 0x007fffff
+	exponent := uint(compact >> 24)
+
+	var target *big.Int
+	if exponent <= 3 {
+		mantissa >>= 8 * (3 - exponent)
+		target = big.NewInt(int64(mantissa))
+	} else {
+		target = big.NewInt(int64(mantissa))
+		target.Lsh(target, 8*(exponent-3))
+	}
+
+	return target
+}
+
+// convert a 256 bit target into its compact "bits" representation
+func BigToCompact(target *big.Int) uint32 {
+	if target.Sign() <= 0 {
+		return 0
+	}
+
+	var mantissa uint32
+	exponent := uint(len(target.Bytes()))
+	if exponent <= 3 {
+		mantissa = uint32(target.Uint64())
+		mantissa <<= 8 * (3 - exponent)
+	} else {
+		shifted := new(big.Int).Rsh(target, 8*(exponent-3))
+		mantissa = uint32(shifted.Uint64())
+	}
+
+	// the 0x00800000 bit is a sign bit in the compact format, so move the mantissa a byte down
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		exponent++
+	}
+
+	return uint32(exponent<<24) | mantissa
+}
+
+// calculate the target bits the block built on top of prevHash must carry
+func (chain *BlockChain) CalcNextBits(prevHash []byte) (uint32, error) {
+	// the genesis block starts at the easiest difficulty, where chains without retargeting stay
+	if len(prevHash) == 0 || chain.Params.NoRetargeting {
+		return BigToCompact(chain.PowLimit()), nil
+	}
+
+	prev, err := chain.GetBlock(prevHash)
+	if err != nil {
+		return 0, err
+	}
+
+	// only retarget at the boundary of a window, otherwise keep the parent's target
+	interval := chain.Params.RetargetInterval
+	if (prev.Height+1)%interval != 0 {
+		return prev.Bits, nil
+	}
+
+	// walk back to the first block of the window that just ended
+	first := prev
+	for range interval - 1 {
+		if len(first.PrevHash) == 0 {
+			break
+		}
+		first, err = chain.GetBlock(first.PrevHash)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return retarget(chain.Params, chain.PowLimit(), prev.Bits, first.Timestamp, prev.Timestamp, int64(prev.Height-first.Height)), nil
+}
+
+// scale the old target by how long the window actually took compared to how long it should have taken
+func retarget(p *params.ChainParams, limit *big.Int, bits uint32, firstTimestamp, lastTimestamp, blocks int64) uint32 {
+	expected := blocks * p.TargetSpacing
+	if expected <= 0 {
+		return bits
+	}
+
+	// limit the adjustment to a factor of 4 in either direction so a few
+	// blocks with odd timestamps can't swing the difficulty wildly
+	actual := lastTimestamp - firstTimestamp
+	actual = max(actual, expected/4)
+	actual = min(actual, expected*4)
+
+	target := CompactToBig(bits)
+	target.Mul(target, big.NewInt(actual))
+	target.Div(target, big.NewInt(expected))
+
+	if target.Cmp(limit) > 0 {
+		target.Set(limit)
+	}
+
+	return BigToCompact(target)
+}
@@ -0,0 +1,112 @@
+package blockchain
+
+import (
+	"golang-blockchain/params"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// a regtest chain that retargets, with the clock far enough ahead for blocks spaced out over a long time
+func newRetargetingTestChain(t *testing.T) *BlockChain {
+	t.Helper()
+
+	chainParams := params.RegTest
+	chainParams.NoRetargeting = false
+
+	clock := &fakeClock{time.Now()}
+	chain, _ := newTestChain(t, chainParams, clock)
+	clock.now = clock.now.Add(1000 * time.Hour)
+
+	return chain
+}
+
+// add n blocks on top of the chain's tip, each spacing seconds after the one before, at the target the chain expects
+func addSpacedBlocks(t *testing.T, chain *BlockChain, n int, spacing int64) {
+	t.Helper()
+
+	for range n {
+		tip := tipBlock(t, chain)
+
+		bits, err := chain.CalcNextBits(tip.Hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		block := buildBlock(t, chain, tip, newCoinbase(chain, tip.Height+1))
+		block.Timestamp = tip.Timestamp + spacing
+		block.Bits = bits
+		reseal(t, chain, block)
+		addBlocks(t, chain, block)
+	}
+}
+
+// the target the chain expects for the block after its tip
+func nextTarget(t *testing.T, chain *BlockChain) *big.Int {
+	t.Helper()
+
+	bits, err := chain.CalcNextBits(chain.LastHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return CompactToBig(bits)
+}
+
+// the target, scaled by num/den and expanded from its compact form, the way targets are stored
+func scaledTarget(target *big.Int, num, den int64) *big.Int {
+	scaled := new(big.Int).Mul(target, big.NewInt(num))
+	scaled.Div(scaled, big.NewInt(den))
+
+	return CompactToBig(BigToCompact(scaled))
+}
+
+func TestRetargetWindow(t *testing.T) {
+	chain := newRetargetingTestChain(t)
+	interval, spacing := chain.Params.RetargetInterval, chain.Params.TargetSpacing
+	limit := chain.PowLimit()
+
+	// blocks come twice as fast as they should
+	addSpacedBlocks(t, chain, interval-2, spacing/2)
+	if target := nextTarget(t, chain); target.Cmp(limit) != 0 {
+		t.Fatalf("expected the target to stay at the limit within the window, got %x", target)
+	}
+
+	// the window from the genesis block to the one before the boundary spans interval-1 spacings, not interval
+	addSpacedBlocks(t, chain, 1, spacing/2)
+	if target, expected := nextTarget(t, chain), scaledTarget(limit, 1, 2); target.Cmp(expected) != 0 {
+		t.Fatalf("expected the target to halve to %x at the boundary, got %x", expected, target)
+	}
+
+	// and the new target holds for the whole next window
+	addSpacedBlocks(t, chain, interval-1, spacing)
+	if target, expected := nextTarget(t, chain), scaledTarget(limit, 1, 2); target.Cmp(expected) != 0 {
+		t.Fatalf("expected the target to stay at %x within the window, got %x", expected, target)
+	}
+}
+
+func TestRetargetClamp(t *testing.T) {
+	chain := newRetargetingTestChain(t)
+	interval, spacing := chain.Params.RetargetInterval, chain.Params.TargetSpacing
+	expectedTimespan := int64(interval-1) * spacing
+
+	// a window mined far too fast makes mining at most 4 times harder
+	addSpacedBlocks(t, chain, interval-1, 1)
+	limited := scaledTarget(chain.PowLimit(), expectedTimespan/4, expectedTimespan)
+	if target := nextTarget(t, chain); target.Cmp(limited) != 0 {
+		t.Fatalf("expected the target to drop by a factor of 4 to %x, got %x", limited, target)
+	}
+
+	// one mined far too slowly makes it at most 4 times easier
+	addSpacedBlocks(t, chain, interval, 100*spacing)
+	eased := scaledTarget(limited, 4, 1)
+	if target := nextTarget(t, chain); target.Cmp(eased) != 0 {
+		t.Fatalf("expected the target to rise by a factor of 4 to %x, got %x", eased, target)
+	}
+
+	// but never past the limit
+	addSpacedBlocks(t, chain, interval, 100*spacing)
+	if target := nextTarget(t, chain); target.Cmp(chain.PowLimit()) != 0 {
+		t.Fatalf("expected the target to stop at the limit %x, got %x", chain.PowLimit(), target)
+	}
+}
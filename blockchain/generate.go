@@ -0,0 +1,34 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrGenerateNotAllowed is returned when blocks are generated on a network that doesn't allow it
+var ErrGenerateNotAllowed = errors.New("generating blocks is not allowed on this network")
+
+// mine n blocks on top of the chain's tip, each paying its subsidy to the given address
+// meant for networks with trivial difficulty, such as regtest, where it advances the chain instantly
+func (chain *BlockChain) GenerateBlocks(n int, address string) ([]*Block, error) {
+	if !chain.Params.AllowGenerate {
+		return nil, fmt.Errorf("%w: %s", ErrGenerateNotAllowed, chain.Params.Name)
+	}
+
+	var blocks []*Block
+
+	for range n {
+		height := chain.GetBestHeight() + 1
+		coinbase := CoinbaseTx(address, "", chain.Params.BlockSubsidy(height))
+
+		block, err := chain.MineBlockContext(context.Background(), []*Transaction{coinbase})
+		if err != nil {
+			return blocks, err
+		}
+
+		blocks = append(blocks, block)
+	}
+
+	return blocks, nil
+}
@@ -0,0 +1,203 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang-blockchain/wallet"
+	"os"
+
+	"github.com/dgraph-io/badger"
+)
+
+// a hash time-locked contract funded on the chain: the output locked to the hash of the HTLC script
+// the parties of an atomic swap exchange these, so each can check and redeem the other's
+type HTLCContract struct {
+	Script Script // the HTLC script, see HTLCScript
+	TxID   []byte // the transaction funding the contract
+	Output int    // the index of the output locked to the script's hash
+	Value  int
+}
+
+// lock amount tokens from the wallet in a new contract paying the owner of the recipient address against
+// the secret hashing to secretHash, and refunding the wallet once the chain is past lockTime
+func NewHTLCContract(w *wallet.Wallet, recipient string, secretHash []byte, lockTime uint32, amount, fee int, UTXO *UTXOSet) (*HTLCContract, *Transaction, error) {
+	recipientHash, ok := LockingScript(recipient).PublicKeyHash()
+	if !ok {
+		return nil, nil, errors.New("contracts can only pay to the address of a key")
+	}
+
+	if len(secretHash) != sha256.Size {
+		return nil, nil, errors.New("the secret hash must be a SHA-256")
+	}
+
+	script := HTLCScript(secretHash, recipientHash, wallet.PublicKeyHash(w.PublicKey), lockTime)
+	tx := NewScriptTransaction(w, P2SHScript(wallet.PublicKeyHash(script)), amount, fee, UTXO)
+
+	return &HTLCContract{script, tx.ID, 0, amount}, tx, nil
+}
+
+// create a transaction redeeming the contract with the secret, paying its value, minus the fee, to the wallet,
+// which has to be the contract's recipient
+func (c *HTLCContract) Redeem(w *wallet.Wallet, secret []byte, fee int) (*Transaction, error) {
+	secretHash, recipient, _, _, ok := c.Script.HTLC()
+	if !ok {
+		return nil, errors.New("not an HTLC script")
+	}
+
+	if hash := sha256.Sum256(secret); len(secret) != 32 || !bytes.Equal(hash[:], secretHash) {
+		return nil, errors.New("the secret doesn't match the contract's hash")
+	}
+
+	if !bytes.Equal(wallet.PublicKeyHash(w.PublicKey), recipient) {
+		return nil, errors.New("the wallet isn't the contract's recipient")
+	}
+
+	tx, err := c.spend(w, 0, fee)
+	if err != nil {
+		return nil, err
+	}
+
+	signature := tx.signInput(0, c.Script, w.PrivateKey)
+	tx.Inputs[0].ScriptSig = HTLCRedeemScriptSig(signature, publicKeyBytes(w.PrivateKey), secret, c.Script)
+
+	return tx, nil
+}
+
+// create a transaction refunding the contract, paying its value, minus the fee, back to the wallet,
+// which has to be the contract's sender
+// the transaction is locked until the contract's lock time, so it can only be mined once the chain is past it
+func (c *HTLCContract) Refund(w *wallet.Wallet, fee int, chain *BlockChain) (*Transaction, error) {
+	_, _, refund, lockTime, ok := c.Script.HTLC()
+	if !ok {
+		return nil, errors.New("not an HTLC script")
+	}
+
+	if !bytes.Equal(wallet.PublicKeyHash(w.PublicKey), refund) {
+		return nil, errors.New("the wallet isn't the contract's sender")
+	}
+
+	if reached, err := chain.IsLockTimeReached(lockTime); err != nil {
+		return nil, err
+	} else if !reached {
+		return nil, fmt.Errorf("the contract can't be refunded before the chain is past %d", lockTime)
+	}
+
+	tx, err := c.spend(w, lockTime, fee)
+	if err != nil {
+		return nil, err
+	}
+
+	signature := tx.signInput(0, c.Script, w.PrivateKey)
+	tx.Inputs[0].ScriptSig = HTLCRefundScriptSig(signature, publicKeyBytes(w.PrivateKey), c.Script)
+
+	return tx, nil
+}
+
+// an unsigned transaction spending the contract's output to the wallet
+// the input's sequence isn't final, so the lock time applies
+func (c *HTLCContract) spend(w *wallet.Wallet, lockTime uint32, fee int) (*Transaction, error) {
+	if c.Value <= fee {
+		return nil, fmt.Errorf("the contract's %d tokens don't cover the fee", c.Value)
+	}
+
+	address := fmt.Sprintf("%s", w.Address())
+	tx := Transaction{nil, []TransactionInput{{c.TxID, c.Output, nil, 0}}, []TransactionOutput{*NewTransactionOutput(c.Value-fee, address)}, lockTime}
+	tx.ID = tx.hash()
+
+	return &tx, nil
+}
+
+// whether the contract's output is in the UTXO set, locked to the hash of its script and holding its value
+// the recipient checks this before locking their own side of a swap
+func (u *UTXOSet) IsHTLCFunded(c *HTLCContract) bool {
+	funded := false
+
+	err := u.Blockchain.Database.View(func(txn *badger.Txn) error {
+		outs, err := getOutputs(txn, c.TxID)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		out, ok := outs.Outputs[c.Output]
+		funded = ok && out.Value == c.Value && bytes.Equal(out.ScriptPubKey, P2SHScript(wallet.PublicKeyHash(c.Script)))
+
+		return nil
+	})
+	Handle(err)
+
+	return funded
+}
+
+// look through the chain for the transaction redeeming the contract, returning the secret it revealed
+// this is how the other party of a swap learns the secret, once it was used to redeem their contract
+func (chain *BlockChain) FindHTLCSecret(c *HTLCContract) ([]byte, error) {
+	secretHash, _, _, _, ok := c.Script.HTLC()
+	if !ok {
+		return nil, errors.New("not an HTLC script")
+	}
+
+	iter := chain.Iterator()
+
+	for {
+		block := iter.Next()
+
+		for _, tx := range block.Transactions {
+			for _, in := range tx.Inputs {
+				if !bytes.Equal(in.ID, c.TxID) || in.Output != c.Output {
+					continue
+				}
+
+				// redeeming pushes the signature, the public key, the secret, true and the script
+				pushed, ok := in.ScriptSig.PushedData()
+				if !ok || len(pushed) != 5 {
+					return nil, errors.New("the contract was refunded rather than redeemed")
+				}
+
+				if hash := sha256.Sum256(pushed[2]); !bytes.Equal(hash[:], secretHash) {
+					return nil, errors.New("the contract was refunded rather than redeemed")
+				}
+
+				return pushed[2], nil
+			}
+		}
+
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+
+	return nil, errors.New("the contract hasn't been redeemed yet")
+}
+
+// load a contract from a file written by SaveFile
+func LoadHTLCContract(path string) (*HTLCContract, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var c HTLCContract
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+
+	if _, _, _, _, ok := c.Script.HTLC(); !ok {
+		return nil, fmt.Errorf("%s isn't an HTLC contract", path)
+	}
+
+	return &c, nil
+}
+
+func (c *HTLCContract) SaveFile(path string) {
+	data, err := json.MarshalIndent(c, "", "  ")
+	Handle(err)
+
+	err = os.WriteFile(path, data, 0644)
+	Handle(err)
+}
@@ -0,0 +1,100 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"golang-blockchain/wallet"
+	"testing"
+)
+
+// a chain with a contract locking 10 of the sender's tokens to the recipient until lockTime, a few blocks up
+func newTestContract(t *testing.T) (*BlockChain, *HTLCContract, *wallet.Wallet, *wallet.Wallet, []byte) {
+	t.Helper()
+
+	chain, sender := newFundedTestChain(t)
+	recipient := wallet.MakeWallet()
+
+	secret := []byte("a secret exactly 32 bytes long..")
+	secretHash := sha256.Sum256(secret)
+	lockTime := uint32(chain.GetBestHeight() + 5)
+
+	contract, tx, err := NewHTLCContract(sender, string(recipient.Address()), secretHash[:], lockTime, 10, 0, &UTXOSet{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mineTransactions(t, chain, tx)
+
+	return chain, contract, sender, recipient, secret
+}
+
+// a refund of the contract with the given lock time, which Refund won't make before the contract's is past
+func refundWithLock(contract *HTLCContract, w *wallet.Wallet, lockTime uint32) *Transaction {
+	tx, err := contract.spend(w, lockTime, 0)
+	Handle(err)
+
+	signature := tx.signInput(0, contract.Script, w.PrivateKey)
+	tx.Inputs[0].ScriptSig = HTLCRefundScriptSig(signature, publicKeyBytes(w.PrivateKey), contract.Script)
+
+	return tx
+}
+
+func TestHTLCRedeem(t *testing.T) {
+	chain, contract, _, recipient, secret := newTestContract(t)
+
+	if !(&UTXOSet{chain}).IsHTLCFunded(contract) {
+		t.Fatal("the contract isn't funded")
+	}
+
+	// the recipient's signature alone doesn't unlock the contract without the secret
+	forged, err := contract.spend(recipient, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := forged.signInput(0, contract.Script, recipient.PrivateKey)
+	forged.Inputs[0].ScriptSig = HTLCRedeemScriptSig(signature, publicKeyBytes(recipient.PrivateKey), make([]byte, 32), contract.Script)
+	rejectTransactions(t, chain, ErrBadSignature, forged)
+
+	tx, err := contract.Redeem(recipient, secret, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mineTransactions(t, chain, tx)
+
+	// the redeeming transaction reveals the secret to the sender
+	found, err := chain.FindHTLCSecret(contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(found, secret) {
+		t.Errorf("expected the secret %q to be revealed, got %q", secret, found)
+	}
+}
+
+func TestHTLCRefund(t *testing.T) {
+	chain, contract, sender, _, _ := newTestContract(t)
+	_, _, _, lockTime, _ := contract.Script.HTLC()
+
+	generateUntil(t, chain, int(lockTime))
+
+	if _, err := contract.Refund(sender, 0, chain); err == nil {
+		t.Fatal("refunded the contract before its lock time")
+	}
+
+	// one block early, the refund's own lock time isn't past yet
+	rejectTransactions(t, chain, ErrNonFinalTransaction, refundWithLock(contract, sender, lockTime))
+
+	// and a refund final one block early doesn't meet the contract's lock time
+	rejectTransactions(t, chain, ErrBadSignature, refundWithLock(contract, sender, lockTime-1))
+
+	generateUntil(t, chain, int(lockTime)+1)
+
+	tx, err := contract.Refund(sender, 0, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mineTransactions(t, chain, tx)
+
+	if (&UTXOSet{chain}).IsHTLCFunded(contract) {
+		t.Error("the contract is still funded after the refund")
+	}
+}
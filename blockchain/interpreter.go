@@ -0,0 +1,392 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"golang-blockchain/wallet"
+	"slices"
+)
+
+// limits keeping scripts cheap to run
+const (
+	MaxScriptSize        = 10000 // the most bytes a script may take
+	MaxScriptElementSize = 520   // the most bytes a single stack element may take
+	MaxStackSize         = 1000  // the most elements the stack may hold
+	MaxOpsPerScript      = 201   // the most opcodes other than pushes a script may run, counting every key a multisig check may try
+	MaxMultisigKeys      = 20    // the most public keys a multisig check may take, though MultisigScript only fits 7 within MaxScriptElementSize
+)
+
+// what a script's signature checks are made against, which is the input of the transaction spending the output
+type SignatureChecker interface {
+	// whether the signature was made with the public key over the spending transaction, signing subscript
+	CheckSig(signature, publicKey []byte, subscript Script) bool
+
+	// whether the spending transaction's lock time is of the same kind as lockTime, and at least as late
+	CheckLockTime(lockTime int64) bool
+
+	// whether the spending input's relative lock time is of the same kind as sequence's, and at least as long
+	CheckSequence(sequence int64) bool
+}
+
+// run the unlocking script, then the locking script on top of the stack it left, as in Bitcoin
+// returns nil if the output may be spent, which takes a true value on top of the stack at the end
+// pay-to-script-hash locking scripts only check the last element pushed hashes to the right script,
+// so that script, the redeem script, is then run too, on the stack the unlocking script left beneath it
+func VerifyScript(scriptSig, scriptPubKey Script, checker SignatureChecker) error {
+	if !scriptSig.IsPushOnly() {
+		return errors.New("unlocking script does more than push data")
+	}
+
+	var stack [][]byte
+
+	stack, err := executeScript(scriptSig, stack, checker)
+	if err != nil {
+		return err
+	}
+	pushed := slices.Clone(stack)
+
+	stack, err = executeScript(scriptPubKey, stack, checker)
+	if err != nil {
+		return err
+	}
+
+	if len(stack) == 0 || !asBool(stack[len(stack)-1]) {
+		return errors.New("script evaluated to false")
+	}
+
+	if _, ok := scriptPubKey.ScriptHash(); !ok {
+		return nil
+	}
+
+	redeemScript := Script(pushed[len(pushed)-1])
+
+	stack, err = executeScript(redeemScript, pushed[:len(pushed)-1], checker)
+	if err != nil {
+		return fmt.Errorf("redeem script: %w", err)
+	}
+
+	if len(stack) == 0 || !asBool(stack[len(stack)-1]) {
+		return errors.New("redeem script evaluated to false")
+	}
+
+	return nil
+}
+
+// run the script on the stack, returning the stack it leaves
+func executeScript(script Script, stack [][]byte, checker SignatureChecker) ([][]byte, error) {
+	if len(script) > MaxScriptSize {
+		return nil, fmt.Errorf("script is %d bytes, more than the limit of %d", len(script), MaxScriptSize)
+	}
+
+	instructions, err := script.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	// whether each branch of the conditionals the script is in is being run
+	var conditions []bool
+	ops := 0
+
+	for _, in := range instructions {
+		executing := !slices.Contains(conditions, false)
+
+		if len(in.data) > MaxScriptElementSize {
+			return nil, fmt.Errorf("push of %d bytes is more than the limit of %d", len(in.data), MaxScriptElementSize)
+		}
+
+		if !isPush(in.op) {
+			if ops++; ops > MaxOpsPerScript {
+				return nil, fmt.Errorf("script runs more than %d opcodes", MaxOpsPerScript)
+			}
+		}
+
+		// a multisig check counts once more for every key it may try
+		if executing && (in.op == OP_CHECKMULTISIG || in.op == OP_CHECKMULTISIGVERIFY) && len(stack) > 0 {
+			if keys, err := decodeNum(stack[len(stack)-1], 4); err == nil && keys > 0 && keys <= MaxMultisigKeys {
+				if ops += int(keys); ops > MaxOpsPerScript {
+					return nil, fmt.Errorf("script runs more than %d opcodes", MaxOpsPerScript)
+				}
+			}
+		}
+
+		// branches that aren't run still need their conditionals tracked
+		if !executing && (in.op < OP_IF || in.op > OP_ENDIF) {
+			continue
+		}
+
+		if isPush(in.op) {
+			stack = append(stack, in.pushed())
+		} else {
+			stack, conditions, err = executeOp(in.op, stack, conditions, executing, script, checker)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", opName(in.op), err)
+			}
+		}
+
+		if len(stack) > MaxStackSize {
+			return nil, fmt.Errorf("stack holds more than %d elements", MaxStackSize)
+		}
+	}
+
+	if len(conditions) > 0 {
+		return nil, errors.New("unbalanced conditional")
+	}
+
+	return stack, nil
+}
+
+var errStackUnderflow = errors.New("not enough elements on the stack")
+
+// run a single opcode that isn't a push
+func executeOp(op byte, stack [][]byte, conditions []bool, executing bool, script Script, checker SignatureChecker) ([][]byte, []bool, error) {
+	switch op {
+	case OP_NOP:
+
+	case OP_IF, OP_NOTIF:
+		condition := false
+		if executing {
+			if len(stack) < 1 {
+				return nil, nil, errStackUnderflow
+			}
+			condition = asBool(stack[len(stack)-1]) == (op == OP_IF)
+			stack = stack[:len(stack)-1]
+		}
+		conditions = append(conditions, condition)
+
+	case OP_ELSE:
+		if len(conditions) == 0 {
+			return nil, nil, errors.New("unbalanced conditional")
+		}
+		conditions[len(conditions)-1] = !conditions[len(conditions)-1]
+
+	case OP_ENDIF:
+		if len(conditions) == 0 {
+			return nil, nil, errors.New("unbalanced conditional")
+		}
+		conditions = conditions[:len(conditions)-1]
+
+	case OP_VERIFY:
+		if len(stack) < 1 {
+			return nil, nil, errStackUnderflow
+		}
+		if !asBool(stack[len(stack)-1]) {
+			return nil, nil, errors.New("verification failed")
+		}
+		stack = stack[:len(stack)-1]
+
+	case OP_RETURN:
+		return nil, nil, errors.New("output is unspendable")
+
+	case OP_DROP:
+		if len(stack) < 1 {
+			return nil, nil, errStackUnderflow
+		}
+		stack = stack[:len(stack)-1]
+
+	case OP_DUP:
+		if len(stack) < 1 {
+			return nil, nil, errStackUnderflow
+		}
+		stack = append(stack, stack[len(stack)-1])
+
+	case OP_NIP:
+		if len(stack) < 2 {
+			return nil, nil, errStackUnderflow
+		}
+		stack = append(stack[:len(stack)-2], stack[len(stack)-1])
+
+	case OP_OVER:
+		if len(stack) < 2 {
+			return nil, nil, errStackUnderflow
+		}
+		stack = append(stack, stack[len(stack)-2])
+
+	case OP_SWAP:
+		if len(stack) < 2 {
+			return nil, nil, errStackUnderflow
+		}
+		stack[len(stack)-1], stack[len(stack)-2] = stack[len(stack)-2], stack[len(stack)-1]
+
+	case OP_SIZE:
+		if len(stack) < 1 {
+			return nil, nil, errStackUnderflow
+		}
+		stack = append(stack, encodeNum(int64(len(stack[len(stack)-1]))))
+
+	case OP_EQUAL, OP_EQUALVERIFY:
+		if len(stack) < 2 {
+			return nil, nil, errStackUnderflow
+		}
+		equal := bytes.Equal(stack[len(stack)-2], stack[len(stack)-1])
+		stack = stack[:len(stack)-2]
+
+		if op == OP_EQUALVERIFY {
+			if !equal {
+				return nil, nil, errors.New("elements aren't equal")
+			}
+		} else {
+			stack = append(stack, fromBool(equal))
+		}
+
+	case OP_SHA256, OP_HASH160, OP_HASH256:
+		if len(stack) < 1 {
+			return nil, nil, errStackUnderflow
+		}
+		data := stack[len(stack)-1]
+
+		var hash []byte
+		switch op {
+		case OP_SHA256:
+			sum := sha256.Sum256(data)
+			hash = sum[:]
+		case OP_HASH160:
+			hash = wallet.PublicKeyHash(data)
+		case OP_HASH256:
+			first := sha256.Sum256(data)
+			sum := sha256.Sum256(first[:])
+			hash = sum[:]
+		}
+		stack[len(stack)-1] = hash
+
+	case OP_CHECKSIG, OP_CHECKSIGVERIFY:
+		if len(stack) < 2 {
+			return nil, nil, errStackUnderflow
+		}
+		signature, publicKey := stack[len(stack)-2], stack[len(stack)-1]
+		stack = stack[:len(stack)-2]
+
+		valid := checker.CheckSig(signature, publicKey, script)
+
+		if op == OP_CHECKSIGVERIFY {
+			if !valid {
+				return nil, nil, errors.New("invalid signature")
+			}
+		} else {
+			stack = append(stack, fromBool(valid))
+		}
+
+	case OP_CHECKMULTISIG, OP_CHECKMULTISIGVERIFY:
+		// the stack holds the signatures, their number, the public keys and their number, from the bottom up
+		// unlike Bitcoin's, the check doesn't consume an extra element beneath the signatures
+		if len(stack) < 1 {
+			return nil, nil, errStackUnderflow
+		}
+		keys, err := decodeNum(stack[len(stack)-1], 4)
+		if err != nil {
+			return nil, nil, err
+		}
+		if keys < 0 || keys > MaxMultisigKeys {
+			return nil, nil, fmt.Errorf("number of public keys must be between 0 and %d", MaxMultisigKeys)
+		}
+		stack = stack[:len(stack)-1]
+
+		if len(stack) < int(keys)+1 {
+			return nil, nil, errStackUnderflow
+		}
+		publicKeys := stack[len(stack)-int(keys):]
+		stack = stack[:len(stack)-int(keys)]
+
+		required, err := decodeNum(stack[len(stack)-1], 4)
+		if err != nil {
+			return nil, nil, err
+		}
+		if required < 0 || required > keys {
+			return nil, nil, errors.New("number of signatures must be between 0 and the number of public keys")
+		}
+		stack = stack[:len(stack)-1]
+
+		if len(stack) < int(required) {
+			return nil, nil, errStackUnderflow
+		}
+		signatures := stack[len(stack)-int(required):]
+		stack = stack[:len(stack)-int(required)]
+
+		// every signature has to match one of the keys left after the one matching the previous signature
+		valid := true
+		for i, j := 0, 0; j < len(signatures); i++ {
+			if len(publicKeys)-i < len(signatures)-j {
+				valid = false
+				break
+			}
+			if checker.CheckSig(signatures[j], publicKeys[i], script) {
+				j++
+			}
+		}
+
+		if op == OP_CHECKMULTISIGVERIFY {
+			if !valid {
+				return nil, nil, errors.New("not enough valid signatures")
+			}
+		} else {
+			stack = append(stack, fromBool(valid))
+		}
+
+	case OP_CHECKLOCKTIMEVERIFY:
+		// the lock time is left on the stack, for the script to drop
+		if len(stack) < 1 {
+			return nil, nil, errStackUnderflow
+		}
+		lockTime, err := decodeNum(stack[len(stack)-1], 5)
+		if err != nil {
+			return nil, nil, err
+		}
+		if lockTime < 0 {
+			return nil, nil, errors.New("negative lock time")
+		}
+		if !checker.CheckLockTime(lockTime) {
+			return nil, nil, errors.New("lock time not reached")
+		}
+
+	case OP_CHECKSEQUENCEVERIFY:
+		// the sequence is left on the stack, for the script to drop
+		if len(stack) < 1 {
+			return nil, nil, errStackUnderflow
+		}
+		sequence, err := decodeNum(stack[len(stack)-1], 5)
+		if err != nil {
+			return nil, nil, err
+		}
+		if sequence < 0 {
+			return nil, nil, errors.New("negative sequence")
+		}
+
+		// sequences without a relative lock time make it a no-op
+		if sequence&SequenceLockTimeDisableFlag == 0 && !checker.CheckSequence(sequence) {
+			return nil, nil, errors.New("relative lock time not reached")
+		}
+
+	default:
+		return nil, nil, errors.New("unknown opcode")
+	}
+
+	return stack, conditions, nil
+}
+
+func opName(op byte) string {
+	if name, ok := opcodeNames[op]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("OP_UNKNOWN%d", op)
+}
+
+// any element but zero, including negative zero, counts as true
+func asBool(data []byte) bool {
+	for i, b := range data {
+		if b != 0 {
+			return i != len(data)-1 || b != 0x80
+		}
+	}
+
+	return false
+}
+
+func fromBool(b bool) []byte {
+	if b {
+		return []byte{1}
+	}
+
+	return nil
+}
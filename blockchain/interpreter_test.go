@@ -0,0 +1,113 @@
+package blockchain
+
+import (
+	"bytes"
+	"golang-blockchain/wallet"
+	"slices"
+	"testing"
+)
+
+func TestVerifyScript(t *testing.T) {
+	w, other := wallet.MakeWallet(), wallet.MakeWallet()
+	publicKey, otherPublicKey := publicKeyBytes(w.PrivateKey), publicKeyBytes(other.PrivateKey)
+
+	tx := &Transaction{nil, []TransactionInput{{[]byte("spent"), 0, nil, 0}}, []TransactionOutput{{1, P2PKHScript(wallet.PublicKeyHash(publicKey))}}, 0}
+	tx.ID = tx.hash()
+	checker := &txSignatureChecker{tx, 0}
+
+	p2pkh := P2PKHScript(wallet.PublicKeyHash(publicKey))
+	signature := tx.signInput(0, p2pkh, w.PrivateKey)
+	badSignature := slices.Clone(signature)
+	badSignature[10] ^= 0xff
+
+	redeemScript, err := MultisigScript(1, [][]byte{publicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRedeemScript, err := MultisigScript(1, [][]byte{otherPublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2sh := P2SHScript(wallet.PublicKeyHash(redeemScript))
+	redeemSignature := tx.signInput(0, redeemScript, w.PrivateKey)
+
+	nops := func(n int) Script {
+		return append(bytes.Repeat(Script{OP_NOP}, n), OP_1)
+	}
+
+	tests := []struct {
+		name         string
+		scriptSig    Script
+		scriptPubKey Script
+		ok           bool
+	}{
+		{"p2pkh", P2PKHScriptSig(signature, publicKey), p2pkh, true},
+		{"p2pkh with a bad signature", P2PKHScriptSig(badSignature, publicKey), p2pkh, false},
+		{"p2pkh with another key", P2PKHScriptSig(tx.signInput(0, p2pkh, other.PrivateKey), otherPublicKey), p2pkh, false},
+		{"p2pkh signature over another script", P2PKHScriptSig(redeemSignature, publicKey), p2pkh, false},
+		{"p2sh", MultisigScriptSig([][]byte{redeemSignature}, redeemScript), p2sh, true},
+		{"p2sh with a bad signature", MultisigScriptSig([][]byte{badSignature}, redeemScript), p2sh, false},
+		{"p2sh with another redeem script", MultisigScriptSig([][]byte{tx.signInput(0, otherRedeemScript, other.PrivateKey)}, otherRedeemScript), p2sh, false},
+		{"unlocking script that isn't push only", Script{OP_1, OP_DUP}, Script{OP_DROP}, false},
+		{"op_return", Script{OP_1}, DataScript([]byte("anchored")), false},
+		{"push of the largest element", Script{}.AddData(make([]byte, MaxScriptElementSize)), Script{OP_DROP, OP_1}, true},
+		{"push over the largest element", Script{}.AddData(make([]byte, MaxScriptElementSize+1)), Script{OP_DROP, OP_1}, false},
+		{"most opcodes", nil, nops(MaxOpsPerScript), true},
+		{"too many opcodes", nil, nops(MaxOpsPerScript + 1), false},
+		{"minimal number", Script{OP_0}, Script{OP_CHECKSEQUENCEVERIFY, OP_DROP, OP_1}, true},
+		{"non-minimal number", Script{}.AddData([]byte{0x00}), Script{OP_CHECKSEQUENCEVERIFY, OP_DROP, OP_1}, false},
+		{"false", Script{OP_0}, Script{OP_NOP}, false},
+		{"unbalanced conditional", Script{OP_1}, Script{OP_IF, OP_1}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := VerifyScript(test.scriptSig, test.scriptPubKey, checker)
+			if test.ok && err != nil {
+				t.Fatalf("expected the script to pass, got %v", err)
+			}
+			if !test.ok && err == nil {
+				t.Fatal("expected the script to fail")
+			}
+		})
+	}
+}
+
+func TestDecodeNum(t *testing.T) {
+	tests := []struct {
+		data []byte
+		n    int64
+		ok   bool
+	}{
+		{nil, 0, true},
+		{[]byte{0x01}, 1, true},
+		{[]byte{0x81}, -1, true},
+		{[]byte{0x7f}, 127, true},
+		{[]byte{0x80, 0x00}, 128, true},
+		{[]byte{0x80, 0x80}, -128, true},
+		{[]byte{0xff, 0xff, 0xff, 0x7f}, 0x7fffffff, true},
+		{[]byte{0x00}, 0, false},
+		{[]byte{0x80}, 0, false},
+		{[]byte{0x01, 0x00}, 0, false},
+		{[]byte{0x01, 0x80}, 0, false},
+		{[]byte{0x7f, 0x00}, 0, false},
+		{[]byte{0x01, 0x02, 0x03, 0x04, 0x05}, 0, false},
+	}
+
+	for _, test := range tests {
+		n, err := decodeNum(test.data, 4)
+		if test.ok && (err != nil || n != test.n) {
+			t.Errorf("decodeNum(%x): expected %d, got %d, %v", test.data, test.n, n, err)
+		}
+		if !test.ok && err == nil {
+			t.Errorf("decodeNum(%x): expected an error, got %d", test.data, n)
+		}
+	}
+
+	// whatever encodeNum makes decodes back
+	for _, n := range []int64{0, 1, -1, 16, 127, 128, -128, 255, 256, 0x7fffffff, -0x7fffffff} {
+		if decoded, err := decodeNum(encodeNum(n), 4); err != nil || decoded != n {
+			t.Errorf("decodeNum(encodeNum(%d)): got %d, %v", n, decoded, err)
+		}
+	}
+}
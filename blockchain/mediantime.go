@@ -0,0 +1,56 @@
+package blockchain
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+const (
+	MedianTimeBlocks   = 11            // number of blocks the median-time-past is computed over
+	MaxFutureBlockTime = 2 * time.Hour // how far ahead of our clock a block's timestamp may be
+)
+
+// Clock tells the chain what time it is, so the timestamp rules can be checked against a fixed time
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// the chain's clock, falling back to the system's when none was set
+func (chain *BlockChain) now() time.Time {
+	if chain.Clock == nil {
+		return systemClock{}.Now()
+	}
+
+	return chain.Clock.Now()
+}
+
+// the median timestamp of the given block and the MedianTimeBlocks-1 blocks before it
+// a new block must be timestamped after this, which keeps a single miner from dragging time backwards
+func (chain *BlockChain) CalcPastMedianTime(hash []byte) (int64, error) {
+	var timestamps []int64
+
+	for len(hash) > 0 && len(timestamps) < MedianTimeBlocks {
+		block, err := chain.GetBlock(hash)
+		if err != nil {
+			return 0, err
+		}
+
+		timestamps = append(timestamps, block.Timestamp)
+		hash = block.PrevHash
+	}
+
+	if len(timestamps) == 0 {
+		return 0, errors.New("no block to compute the median time past from")
+	}
+
+	slices.Sort(timestamps)
+
+	return timestamps[len(timestamps)/2], nil
+}
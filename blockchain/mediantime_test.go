@@ -0,0 +1,77 @@
+package blockchain
+
+import (
+	"context"
+	"golang-blockchain/params"
+	"testing"
+	"time"
+)
+
+func TestCheckBlockHeaderTimestamps(t *testing.T) {
+	clock := &fakeClock{time.Now().Truncate(time.Second)}
+	chain, w := newTestChain(t, params.RegTest, clock)
+
+	// space the blocks out, so the median time past sits well behind the tip
+	for range MedianTimeBlocks {
+		clock.now = clock.now.Add(10 * time.Minute)
+		if _, err := chain.GenerateBlocks(1, string(w.Address())); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tip, err := chain.GetBlock(chain.LastHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	medianTime, err := chain.CalcPastMedianTime(tip.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	maxTime := clock.now.Add(MaxFutureBlockTime).Unix()
+
+	tests := []struct {
+		name      string
+		timestamp int64
+		err       ErrorCode
+		ok        bool
+	}{
+		{"before the median time past", medianTime - 1, ErrTimeTooOld, false},
+		{"at the median time past", medianTime, ErrTimeTooOld, false},
+		{"just after the median time past", medianTime + 1, 0, true},
+		{"at the clock's time", clock.now.Unix(), 0, true},
+		{"at the latest time allowed", maxTime, 0, true},
+		{"past the latest time allowed", maxTime + 1, ErrTimeTooNew, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			coinbase := CoinbaseTx(string(w.Address()), "", chain.Params.BlockSubsidy(tip.Height+1))
+			block, err := chain.createBlock(context.Background(), []*Transaction{coinbase}, tip.Hash, tip.Height+1, test.timestamp)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = chain.checkBlockHeader(block)
+			if test.ok {
+				if err != nil {
+					t.Fatalf("expected the block to be accepted, got %v", err)
+				}
+				return
+			}
+
+			if code := ruleErrorCode(t, err); code != test.err {
+				t.Fatalf("expected %s, got %s", test.err, code)
+			}
+		})
+	}
+}
+
+func TestCalcPastMedianTimeWithoutBlocks(t *testing.T) {
+	chain, _ := newTestChain(t, params.RegTest, nil)
+
+	for _, hash := range [][]byte{nil, {}} {
+		if _, err := chain.CalcPastMedianTime(hash); err == nil {
+			t.Fatalf("expected an error for hash %x", hash)
+		}
+	}
+}
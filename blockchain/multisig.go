@@ -0,0 +1,201 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang-blockchain/wallet"
+	"os"
+
+	"github.com/dgraph-io/badger"
+)
+
+// a transaction spending outputs locked to a multisig script, passed around between the key holders
+// as each of them adds their signatures, until enough of them signed for it to be completed
+// the signatures don't depend on each other, as every signature signs the transaction without its unlocking scripts
+type MultisigTx struct {
+	Transaction  *Transaction
+	RedeemScript Script              // the multisig script
+	Bare         []bool              // whether each input spends an output locked with the bare multisig script rather than its hash
+	Signatures   []map[string][]byte // the signatures of each input, by the hex encoded public key they were made with
+}
+
+// create a transaction sending amount tokens from the outputs locked to the multisig script, either directly or by its hash
+// nobody has signed it yet, and the change goes back to the script's address
+func NewMultisigTx(redeemScript Script, to string, amount, fee int, UTXO *UTXOSet) (*MultisigTx, error) {
+	if _, _, ok := redeemScript.Multisig(); !ok {
+		return nil, errors.New("not a multisig script")
+	}
+
+	p2sh := P2SHScript(wallet.PublicKeyHash(redeemScript))
+
+	acc, validOutputs := UTXO.FindSpendableOutputs([]Script{p2sh, redeemScript}, amount+fee)
+	if acc < amount+fee {
+		return nil, errors.New("not enough funds")
+	}
+
+	multisigTx := &MultisigTx{RedeemScript: redeemScript}
+	var inputs []TransactionInput
+
+	err := UTXO.Blockchain.Database.View(func(txn *badger.Txn) error {
+		for txId, outputs := range validOutputs {
+			txID, err := hex.DecodeString(txId)
+			if err != nil {
+				return err
+			}
+
+			outs, err := getOutputs(txn, txID)
+			if err != nil {
+				return err
+			}
+
+			for _, out := range outputs {
+				inputs = append(inputs, TransactionInput{txID, out, nil, 0})
+				multisigTx.Bare = append(multisigTx.Bare, bytes.Equal(outs.Outputs[out].ScriptPubKey, redeemScript))
+				multisigTx.Signatures = append(multisigTx.Signatures, make(map[string][]byte))
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := []TransactionOutput{*NewTransactionOutput(amount, to)}
+	if acc > amount+fee {
+		outputs = append(outputs, TransactionOutput{acc - amount - fee, p2sh})
+	}
+
+	tx := Transaction{nil, inputs, outputs, 0}
+	tx.ID = tx.hash()
+	multisigTx.Transaction = &tx
+
+	return multisigTx, nil
+}
+
+// the number of signatures the multisig script requires for each input
+func (m *MultisigTx) Required() int {
+	required, _, _ := m.RedeemScript.Multisig()
+
+	return required
+}
+
+// sign every input with the private key, which has to be one of the multisig script's
+func (m *MultisigTx) Sign(privateKey ecdsa.PrivateKey) error {
+	publicKey := publicKeyBytes(privateKey)
+
+	_, publicKeys, ok := m.RedeemScript.Multisig()
+	if !ok {
+		return errors.New("not a multisig script")
+	}
+
+	found := false
+	for _, key := range publicKeys {
+		found = found || bytes.Equal(key, publicKey)
+	}
+	if !found {
+		return fmt.Errorf("public key %x isn't one of the multisig script's", publicKey)
+	}
+
+	// every input spends an output locked with the multisig script, which is what the signatures sign, as it's the script being run
+	for inId := range m.Transaction.Inputs {
+		m.Signatures[inId][hex.EncodeToString(publicKey)] = m.Transaction.signInput(inId, m.RedeemScript, privateKey)
+	}
+
+	return nil
+}
+
+// add the signatures of another copy of the same transaction
+func (m *MultisigTx) Combine(other *MultisigTx) error {
+	if !bytes.Equal(m.Transaction.ID, other.Transaction.ID) || !bytes.Equal(m.RedeemScript, other.RedeemScript) {
+		return errors.New("transactions don't match")
+	}
+
+	for inId, signatures := range other.Signatures {
+		for publicKey, signature := range signatures {
+			m.Signatures[inId][publicKey] = signature
+		}
+	}
+
+	return nil
+}
+
+// the valid signatures of the input, in the order of the multisig script's keys
+func (m *MultisigTx) validSignatures(input int) [][]byte {
+	_, publicKeys, _ := m.RedeemScript.Multisig()
+	checker := &txSignatureChecker{m.Transaction, input}
+
+	var signatures [][]byte
+	for _, publicKey := range publicKeys {
+		signature, ok := m.Signatures[input][hex.EncodeToString(publicKey)]
+		if ok && checker.CheckSig(signature, publicKey, m.RedeemScript) {
+			signatures = append(signatures, signature)
+		}
+	}
+
+	return signatures
+}
+
+// the number of valid signatures made so far, which is the lowest any of the inputs has
+func (m *MultisigTx) Signed() int {
+	signed := -1
+	for inId := range m.Transaction.Inputs {
+		if n := len(m.validSignatures(inId)); signed < 0 || n < signed {
+			signed = n
+		}
+	}
+
+	return max(signed, 0)
+}
+
+// the transaction with its unlocking scripts filled in, once every input has enough valid signatures
+func (m *MultisigTx) Finalize() (*Transaction, error) {
+	required := m.Required()
+	tx := m.Transaction.trimmedCopy()
+
+	for inId := range tx.Inputs {
+		signatures := m.validSignatures(inId)
+		if len(signatures) < required {
+			return nil, fmt.Errorf("input %d has %d of the %d signatures required", inId, len(signatures), required)
+		}
+
+		redeemScript := m.RedeemScript
+		if m.Bare[inId] {
+			redeemScript = nil
+		}
+		tx.Inputs[inId].ScriptSig = MultisigScriptSig(signatures[:required], redeemScript)
+	}
+
+	return &tx, nil
+}
+
+// load a multisig transaction from a file written by SaveFile
+func LoadMultisigTx(path string) (*MultisigTx, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var m MultisigTx
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+
+	if m.Transaction == nil || len(m.Bare) != len(m.Transaction.Inputs) || len(m.Signatures) != len(m.Transaction.Inputs) {
+		return nil, fmt.Errorf("%s isn't a multisig transaction", path)
+	}
+
+	return &m, nil
+}
+
+func (m *MultisigTx) SaveFile(path string) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	Handle(err)
+
+	err = os.WriteFile(path, data, 0644)
+	Handle(err)
+}
@@ -0,0 +1,62 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"golang-blockchain/wallet"
+	"testing"
+)
+
+func TestMultisigSpend(t *testing.T) {
+	chain, w := newFundedTestChain(t)
+	UTXO := &UTXOSet{chain}
+	keys := []*wallet.Wallet{wallet.MakeWallet(), wallet.MakeWallet(), wallet.MakeWallet()}
+
+	redeemScript, err := MultisigScript(2, [][]byte{keys[0].PublicKey, keys[1].PublicKey, keys[2].PublicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mineTransactions(t, chain, NewScriptTransaction(w, P2SHScript(wallet.PublicKeyHash(redeemScript)), 10, 0, UTXO))
+
+	m, err := NewMultisigTx(redeemScript, string(wallet.MakeWallet().Address()), 5, 0, UTXO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []*wallet.Wallet{keys[0], keys[2]} {
+		if err := m.Sign(key.PrivateKey); err != nil {
+			t.Fatal(err)
+		}
+	}
+	signature := func(key *wallet.Wallet) []byte {
+		return m.Signatures[0][hex.EncodeToString(key.PublicKey)]
+	}
+
+	// the transaction unlocked with the signatures given, rather than the ones Finalize picks
+	signedWith := func(signatures ...[]byte) *Transaction {
+		tx := m.Transaction.trimmedCopy()
+		tx.Inputs[0].ScriptSig = MultisigScriptSig(signatures, redeemScript)
+		return &tx
+	}
+
+	t.Run("one of three signatures", func(t *testing.T) {
+		tx := signedWith(signature(keys[0]))
+		if _, err := chain.ValidateTransaction(tx); ruleErrorCode(t, err) != ErrBadSignature {
+			t.Fatalf("expected %s, got %v", ErrBadSignature, err)
+		}
+		rejectTransactions(t, chain, ErrBadSignature, tx)
+	})
+
+	t.Run("signatures out of order", func(t *testing.T) {
+		rejectTransactions(t, chain, ErrBadSignature, signedWith(signature(keys[2]), signature(keys[0])))
+	})
+
+	t.Run("two of three signatures", func(t *testing.T) {
+		tx, err := m.Finalize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := chain.ValidateTransaction(tx); err != nil {
+			t.Fatal(err)
+		}
+		mineTransactions(t, chain, tx)
+	})
+}
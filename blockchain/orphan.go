@@ -0,0 +1,197 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// blocks can arrive before their parent, e.g. when a peer sends us the tip of a branch we haven't seen yet
+// such orphans are held back until their ancestry arrives, instead of being dropped
+
+const (
+	MaxOrphanBlocks   = 100       // the most orphans held at once, the ones expiring first get evicted past it
+	MaxOrphansPerPeer = 20        // the most orphans held from a single peer, so one peer can't crowd out the others
+	OrphanExpiry      = time.Hour // how long an orphan waits for its parent before it is dropped
+)
+
+type orphanBlock struct {
+	block   *Block
+	peer    string // the address of the peer that sent it
+	expires time.Time
+}
+
+// orphans indexed both by their own hash and by the hash of the parent they're waiting on
+type orphanPool struct {
+	mutex    sync.Mutex
+	orphans  map[string]*orphanBlock
+	byParent map[string][]*orphanBlock
+}
+
+// add the block to the chain, or hold it as an orphan if its parent is still unknown
+// returns whether the block was held as an orphan; once a block is added, every orphan descending from it is added as well
+// orphans are only held if their seal is valid on its own, and are counted against the peer that sent them
+func (chain *BlockChain) ProcessBlock(block *Block, peer string) (bool, error) {
+	if chain.IsOrphan(block.Hash) {
+		return true, nil
+	}
+
+	// walking back from the checkpointed block through its orphaned ancestors tells which blocks lead up to it
+	chain.noteCheckpointAncestry(block)
+
+	err := chain.AddBlock(block)
+
+	var ruleErr RuleError
+	if errors.As(err, &ruleErr) && ruleErr.ErrorCode == ErrMissingParent {
+		// without the parent the expected target is unknown, but a valid seal still makes flooding the pool costly
+		if err := chain.Engine.VerifySeal(chain, &block.BlockHeader); err != nil {
+			return false, err
+		}
+
+		chain.addOrphan(block, peer)
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	chain.connectOrphans(block.Hash)
+
+	return false, nil
+}
+
+// check if the block is being held as an orphan
+func (chain *BlockChain) IsOrphan(hash []byte) bool {
+	pool := &chain.orphans
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	_, ok := pool.orphans[hex.EncodeToString(hash)]
+
+	return ok
+}
+
+// the hash of the missing block the orphan ultimately descends from, which is the one to ask peers for
+func (chain *BlockChain) OrphanRoot(hash []byte) []byte {
+	pool := &chain.orphans
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	root := hash
+	for {
+		orphan, ok := pool.orphans[hex.EncodeToString(root)]
+		if !ok {
+			return root
+		}
+		root = orphan.block.PrevHash
+	}
+}
+
+func (chain *BlockChain) addOrphan(block *Block, peer string) {
+	pool := &chain.orphans
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	if pool.orphans == nil {
+		pool.orphans = make(map[string]*orphanBlock)
+		pool.byParent = make(map[string][]*orphanBlock)
+	}
+
+	now := chain.now()
+	for _, orphan := range pool.orphans {
+		if now.After(orphan.expires) {
+			pool.remove(orphan)
+		}
+	}
+
+	// make room by evicting the orphan closest to expiring, first among the peer's own orphans, then among everyone's
+	fromPeer := func(orphan *orphanBlock) bool { return orphan.peer == peer }
+	for pool.count(fromPeer) >= MaxOrphansPerPeer {
+		pool.remove(pool.oldest(fromPeer))
+	}
+	anyone := func(*orphanBlock) bool { return true }
+	for len(pool.orphans) >= MaxOrphanBlocks {
+		pool.remove(pool.oldest(anyone))
+	}
+
+	orphan := &orphanBlock{block, peer, now.Add(OrphanExpiry)}
+	parent := hex.EncodeToString(block.PrevHash)
+
+	pool.orphans[hex.EncodeToString(block.Hash)] = orphan
+	pool.byParent[parent] = append(pool.byParent[parent], orphan)
+}
+
+// the number of orphans matching the filter
+func (pool *orphanPool) count(match func(*orphanBlock) bool) int {
+	count := 0
+	for _, orphan := range pool.orphans {
+		if match(orphan) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// the orphan closest to expiring among the ones matching the filter
+func (pool *orphanPool) oldest(match func(*orphanBlock) bool) *orphanBlock {
+	var oldest *orphanBlock
+	for _, orphan := range pool.orphans {
+		if !match(orphan) {
+			continue
+		}
+		if oldest == nil || orphan.expires.Before(oldest.expires) {
+			oldest = orphan
+		}
+	}
+
+	return oldest
+}
+
+func (pool *orphanPool) remove(orphan *orphanBlock) {
+	delete(pool.orphans, hex.EncodeToString(orphan.block.Hash))
+
+	parent := hex.EncodeToString(orphan.block.PrevHash)
+	siblings := pool.byParent[parent]
+	for i, sibling := range siblings {
+		if sibling == orphan {
+			siblings = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+
+	if len(siblings) == 0 {
+		delete(pool.byParent, parent)
+	} else {
+		pool.byParent[parent] = siblings
+	}
+}
+
+// add the orphans waiting on the given block, then the ones waiting on those, and so on
+func (chain *BlockChain) connectOrphans(hash []byte) {
+	pool := &chain.orphans
+	parents := [][]byte{hash}
+
+	for len(parents) > 0 {
+		parent := hex.EncodeToString(parents[0])
+		parents = parents[1:]
+
+		pool.mutex.Lock()
+		children := pool.byParent[parent]
+		for _, child := range children {
+			pool.remove(child)
+		}
+		pool.mutex.Unlock()
+
+		for _, child := range children {
+			if err := chain.AddBlock(child.block); err != nil {
+				fmt.Printf("Dropped orphan block %x: %s\n", child.block.Hash, err)
+				continue
+			}
+
+			parents = append(parents, child.block.Hash)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"golang-blockchain/params"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// n blocks building on each other whose first parent the chain never sees, so every one of them is an orphan
+func buildOrphans(t *testing.T, chain *BlockChain, n int) []*Block {
+	t.Helper()
+
+	return buildBranch(t, chain, tipBlock(t, chain), n+1)[1:]
+}
+
+func processOrphan(t *testing.T, chain *BlockChain, block *Block, peer string) {
+	t.Helper()
+
+	if orphan, err := chain.ProcessBlock(block, peer); err != nil || !orphan {
+		t.Fatalf("expected block %d to be held as an orphan, got %v", block.Height, err)
+	}
+}
+
+func TestConnectOrphans(t *testing.T) {
+	chain, _ := newTestChain(t, params.RegTest, &fakeClock{time.Now()})
+	branch := buildBranch(t, chain, tipBlock(t, chain), 3)
+
+	processOrphan(t, chain, branch[2], "peer")
+	processOrphan(t, chain, branch[1], "peer")
+
+	if root := chain.OrphanRoot(branch[2].Hash); !bytes.Equal(root, branch[0].Hash) {
+		t.Fatalf("expected the orphans to be missing %x, got %x", branch[0].Hash, root)
+	}
+
+	if orphan, err := chain.ProcessBlock(branch[0], "peer"); err != nil || orphan {
+		t.Fatalf("expected the missing block to be added, got %v", err)
+	}
+
+	checkTip(t, chain, branch[2])
+	for _, block := range branch {
+		if chain.IsOrphan(block.Hash) {
+			t.Errorf("block %d is still held as an orphan", block.Height)
+		}
+	}
+}
+
+func TestOrphanExpiry(t *testing.T) {
+	clock := &fakeClock{time.Now()}
+	chain, _ := newTestChain(t, params.RegTest, clock)
+	orphans := buildOrphans(t, chain, 2)
+
+	processOrphan(t, chain, orphans[0], "peer")
+
+	// expired orphans are dropped the next time one is added
+	clock.now = clock.now.Add(OrphanExpiry + time.Second)
+	processOrphan(t, chain, orphans[1], "peer")
+
+	if chain.IsOrphan(orphans[0].Hash) {
+		t.Error("the expired orphan is still held")
+	}
+	if !chain.IsOrphan(orphans[1].Hash) {
+		t.Error("the fresh orphan was dropped")
+	}
+}
+
+func TestOrphanEviction(t *testing.T) {
+	t.Run("per peer", func(t *testing.T) {
+		clock := &fakeClock{time.Now()}
+		chain, _ := newTestChain(t, params.RegTest, clock)
+		orphans := buildOrphans(t, chain, MaxOrphansPerPeer+2)
+
+		processOrphan(t, chain, orphans[0], "other")
+
+		// one more than the peer may have
+		for _, block := range orphans[1:] {
+			clock.now = clock.now.Add(time.Second)
+			processOrphan(t, chain, block, "peer")
+		}
+
+		// the peer only pushed out its own oldest orphan
+		if !chain.IsOrphan(orphans[0].Hash) {
+			t.Error("another peer's orphan was evicted")
+		}
+		if chain.IsOrphan(orphans[1].Hash) {
+			t.Error("the peer's oldest orphan wasn't evicted")
+		}
+		for _, block := range orphans[2:] {
+			if !chain.IsOrphan(block.Hash) {
+				t.Errorf("orphan %d was evicted", block.Height)
+			}
+		}
+	})
+
+	t.Run("across peers", func(t *testing.T) {
+		clock := &fakeClock{time.Now()}
+		chain, _ := newTestChain(t, params.RegTest, clock)
+		orphans := buildOrphans(t, chain, MaxOrphanBlocks+1)
+
+		// spread over enough peers to stay under the per peer cap
+		for i, block := range orphans {
+			clock.now = clock.now.Add(time.Second)
+			processOrphan(t, chain, block, fmt.Sprintf("peer%d", i%(MaxOrphanBlocks/MaxOrphansPerPeer+1)))
+		}
+
+		if chain.IsOrphan(orphans[0].Hash) {
+			t.Error("the oldest orphan wasn't evicted")
+		}
+		for _, block := range orphans[1:] {
+			if !chain.IsOrphan(block.Hash) {
+				t.Errorf("orphan %d was evicted", block.Height)
+			}
+		}
+	})
+}
+
+func TestOrphanSeal(t *testing.T) {
+	chain, _ := newTestChain(t, params.RegTest, &fakeClock{time.Now()})
+
+	tests := []struct {
+		name string
+		bits uint32
+		err  ErrorCode
+	}{
+		{"target above the limit", BigToCompact(new(big.Int).Lsh(chain.PowLimit(), 1)), ErrBadTarget},
+		{"target of zero", 0, ErrBadTarget},
+		{"hash above the target", 0x03000001, ErrBadProofOfWork},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			block := buildOrphans(t, chain, 1)[0]
+
+			// claiming other bits without sealing the block again
+			block.Bits = test.bits
+			block.Hash = block.BlockHeader.Hash()
+
+			if _, err := chain.ProcessBlock(block, "peer"); ruleErrorCode(t, err) != test.err {
+				t.Fatalf("expected %s, got %v", test.err, err)
+			}
+			if chain.IsOrphan(block.Hash) {
+				t.Error("the block was held as an orphan")
+			}
+		})
+	}
+}
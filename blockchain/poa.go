@@ -0,0 +1,130 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"golang-blockchain/wallet"
+	"math/big"
+	"slices"
+)
+
+// the proof-of-authority engine: blocks are sealed by signing them with one of a fixed set of keys
+// there is no work to do, so test networks run on it without burning CPU
+type PoaEngine struct {
+	Signers [][]byte // public key hashes allowed to seal blocks
+
+	key       *ecdsa.PrivateKey // the key this node seals blocks with
+	publicKey []byte
+}
+
+// seal blocks with the wallet's key, which has to be one of the signers
+func (poa *PoaEngine) Authorize(w *wallet.Wallet) error {
+	if !poa.isSigner(w.PublicKey) {
+		return fmt.Errorf("%s is not allowed to seal blocks", w.Address())
+	}
+
+	poa.key = &w.PrivateKey
+	poa.publicKey = w.PublicKey
+
+	return nil
+}
+
+func (poa *PoaEngine) isSigner(publicKey []byte) bool {
+	publicKeyHash := wallet.PublicKeyHash(publicKey)
+
+	return slices.ContainsFunc(poa.Signers, func(signer []byte) bool {
+		return bytes.Equal(signer, publicKeyHash)
+	})
+}
+
+// authority blocks carry no target or nonce
+func (poa *PoaEngine) Prepare(chain *BlockChain, header *BlockHeader) error {
+	header.Bits = 0
+	header.Nonce = 0
+
+	return nil
+}
+
+func (poa *PoaEngine) Seal(ctx context.Context, chain *BlockChain, block *Block) error {
+	if poa.key == nil {
+		return errors.New("no signing key authorized to seal blocks")
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	block.Signer = poa.publicKey
+
+	r, s, err := ecdsa.Sign(rand.Reader, poa.key, block.SealHash())
+	if err != nil {
+		return err
+	}
+
+	// (r, n-s) is just as valid a signature, so only the lower of the two is accepted
+	if isHighS(s) {
+		s.Sub(elliptic.P256().Params().N, s)
+	}
+
+	// both components are padded to 32 bytes so the signature can be split back in half
+	block.Signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	block.Hash = block.BlockHeader.Hash()
+
+	return nil
+}
+
+func (poa *PoaEngine) VerifyHeader(chain *BlockChain, header *BlockHeader) error {
+	hash := header.Hash()
+
+	if header.Bits != 0 {
+		return ruleError(ErrBadTarget, "authority block %x carries target bits %08x", hash, header.Bits)
+	}
+
+	if !poa.isSigner(header.Signer) {
+		return ruleError(ErrUnauthorizedSigner, "block %x is sealed by %x, which is not an authority", hash, header.Signer)
+	}
+
+	if len(header.Signer) != 64 || len(header.Signature) != 64 {
+		return ruleError(ErrBadBlockSignature, "block %x's signature is malformed", hash)
+	}
+
+	// deconstruct the signer's key into its coordinates, and the signature into its components
+	x := new(big.Int).SetBytes(header.Signer[:32])
+	y := new(big.Int).SetBytes(header.Signer[32:])
+	r := new(big.Int).SetBytes(header.Signature[:32])
+	s := new(big.Int).SetBytes(header.Signature[32:])
+
+	// otherwise anyone could flip s into n-s, making another valid block with a different hash
+	if isHighS(s) {
+		return ruleError(ErrBadBlockSignature, "block %x's signature isn't in its low-S form", hash)
+	}
+
+	publicKey := ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+	if !ecdsa.Verify(&publicKey, header.SealHash(), r, s) {
+		return ruleError(ErrBadBlockSignature, "block %x's signature is invalid", hash)
+	}
+
+	return nil
+}
+
+// authority blocks don't depend on their parent to be verified
+func (poa *PoaEngine) VerifySeal(chain *BlockChain, header *BlockHeader) error {
+	return poa.VerifyHeader(chain, header)
+}
+
+// whether the signature's s is in the upper half of the curve's order
+func isHighS(s *big.Int) bool {
+	halfOrder := new(big.Int).Rsh(elliptic.P256().Params().N, 1)
+
+	return s.Cmp(halfOrder) > 0
+}
+
+// every authority block weighs the same, so the longest chain wins
+func (poa *PoaEngine) Work(header *BlockHeader) *big.Int {
+	return big.NewInt(1)
+}
@@ -2,10 +2,17 @@ package blockchain
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
-	"fmt"
+	"encoding/binary"
 	"math"
 	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
 )
 
 // retrieve data from the block
@@ -14,79 +21,227 @@ import (
 // check the hash to see if it meets a set of requirements
 
 // requirements:
-// first few bytes of the has must contain 0s
+// the hash must be smaller than the target carried by the block (its "bits")
+
+const hashrateInterval = time.Second // how often the hashrate gets reported
+
+// a hash function proof-of-work can be done with
+type PowHash struct {
+	Sum   func(data []byte) []byte
+	Batch uint64 // number of hashes a worker tries between two cancellation checks
+}
+
+// SHA-256, cheap to compute and easily sped up by dedicated hardware
+var SHA256Hash = PowHash{
+	Sum: func(data []byte) []byte {
+		hash := sha256.Sum256(data)
+		return hash[:]
+	},
+	Batch: 1 << 12,
+}
+
+// scrypt needs 128KB of memory for every hash, which takes away most of the edge GPUs and ASICs have
+// the header doubles as the salt, as in Litecoin
+var ScryptHash = PowHash{
+	Sum: func(data []byte) []byte {
+		hash, err := scrypt.Key(data, data, 1024, 1, 1, 32)
+		Handle(err)
+		return hash
+	},
+	Batch: 1 << 4,
+}
 
-const Difficulty = 20
+// HashrateFunc receives the number of hashes per second the miner is currently doing
+type HashrateFunc func(hashesPerSecond float64)
 
 type ProofOfWork struct {
 	Block  *Block
 	Target *big.Int
+	Hash   PowHash // the hash that has to meet the target
 }
 
+// a SHA-256 proof-of-work for the block
 func NewProof(b *Block) *ProofOfWork {
-	target := big.NewInt(1)
+	return NewProofWithHash(b, SHA256Hash)
+}
 
-	// left shift the bytes 256-Difficulty times
-	// 256 is used because it represents the size of the block's hash
-	// the number 00000000....000001 would now be 0000...0001000...000000
-	//            ^256th bit       ^1st bit                 ^"difficulty"th bit
-	target.Lsh(target, uint(256-Difficulty))
+// a proof-of-work for the block using the given hash function
+func NewProofWithHash(b *Block, hash PowHash) *ProofOfWork {
+	// expand the block's compact bits into the full 256 bit target
+	target := CompactToBig(b.Bits)
 
-	return &ProofOfWork{b, target}
+	return &ProofOfWork{b, target, hash}
 }
 
-func (proof *ProofOfWork) InitData(nonce int) []byte {
-	data := bytes.Join(
-		[][]byte{
-			proof.Block.PrevHash,
-			proof.Block.HashTransactions(),
-			toHex(int64(nonce)),
-			toHex(int64(Difficulty)),
-		},
-		[]byte{},
-	)
-
-	return data
+// the data being hashed is the block's whole header with the given nonce
+func (proof *ProofOfWork) InitData(nonce uint64) []byte {
+	header := proof.Block.BlockHeader
+	header.Nonce = nonce
+
+	return header.Serialize()
 }
 
-func (pow *ProofOfWork) Run() (int, []byte) {
+// mine the block by splitting the nonce space from the block's nonce on between one worker per CPU
+// once a nonce meeting the target is found, the block's header and hash are updated
+// mining stops early, returning the context's error, if ctx is cancelled
+func (pow *ProofOfWork) Run(ctx context.Context, report HashrateFunc) error {
+	var hashes atomic.Uint64
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if report != nil {
+		go reportHashrate(ctx, &hashes, report)
+	}
+
+	for {
+		// workers only check ctx between batches, so with an easy target they'd find a solution before noticing
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if header, ok := pow.search(ctx, &hashes); ok {
+			pow.Block.BlockHeader = header
+			pow.Block.Hash = header.Hash()
+
+			return nil
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// every nonce was tried without success, so roll the timestamp to get a fresh header to work on
+		pow.Block.Timestamp = max(time.Now().Unix(), pow.Block.Timestamp+1)
+		pow.Block.Nonce = 0
+	}
+}
+
+// run one worker per CPU over its own slice of the nonce space left after the block's nonce
+// starting there lets a miner looking for several solutions of the same header pick up after the last one
+// returns false if the whole space was exhausted or ctx was cancelled
+func (pow *ProofOfWork) search(ctx context.Context, hashes *atomic.Uint64) (BlockHeader, bool) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := runtime.NumCPU()
+	first := pow.Block.Nonce
+	stride := (math.MaxUint64 - first) / uint64(workers)
+	if stride == 0 {
+		// too few nonces left to split them up
+		workers = 1
+	}
+	found := make(chan BlockHeader, workers)
+
+	var wg sync.WaitGroup
+	for i := range workers {
+		start := first + uint64(i)*stride
+		end := start + stride - 1
+		if i == workers-1 {
+			end = math.MaxUint64
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pow.work(ctx, start, end, hashes, found)
+		}()
+	}
+
+	// once every worker gave up, there is nothing left to wait for
+	go func() {
+		wg.Wait()
+		close(found)
+	}()
+
+	header, ok := <-found
+
+	return header, ok
+}
+
+// try every nonce in [start, end] until one meets the target
+func (pow *ProofOfWork) work(ctx context.Context, start, end uint64, hashes *atomic.Uint64, found chan<- BlockHeader) {
 	var intHash big.Int
-	var hash [32]byte
 
-	nonce := 0
+	header := pow.Block.BlockHeader
+	data := header.Serialize()
+
+	// only the nonce changes between attempts, so it's patched in place
+	nonceOffset := header.nonceOffset()
+
+	for nonce := start; ; nonce++ {
+		if (nonce-start)%pow.Hash.Batch == 0 && nonce != start {
+			hashes.Add(pow.Hash.Batch)
+			if ctx.Err() != nil {
+				return
+			}
+		}
 
-	for nonce < math.MaxInt64 {
 		// 1. prepare the data
 		// 2. hash the data
 		// 3. convert the hash into big.Int
 		// 4. compare that big.Int with the target, inside the pow
-
-		data := pow.InitData(nonce)
-		hash = sha256.Sum256(data)
-
-		fmt.Printf("\r%x", hash)
-
-		intHash.SetBytes(hash[:])
+		binary.BigEndian.PutUint64(data[nonceOffset:], nonce)
+		hash := pow.Hash.Sum(data)
+		intHash.SetBytes(hash)
 
 		// hash met the target
 		if intHash.Cmp(pow.Target) == -1 {
-			fmt.Println()
-			return nonce, hash[:]
+			header.Nonce = nonce
+			found <- header
+			return
 		}
 
-		nonce++
+		if nonce == end {
+			return
+		}
 	}
+}
+
+// periodically hand the number of hashes per second to the callback until ctx is done
+func reportHashrate(ctx context.Context, hashes *atomic.Uint64, report HashrateFunc) {
+	ticker := time.NewTicker(hashrateInterval)
+	defer ticker.Stop()
+
+	last := time.Now()
+	lastCount := hashes.Load()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			count := hashes.Load()
+			report(float64(count-lastCount) / now.Sub(last).Seconds())
 
-	return 0, []byte{}
+			last, lastCount = now, count
+		}
+	}
 }
 
-// check if the proof-of-work's parameters ensure the target is met
-func (pow *ProofOfWork) Validate() bool {
+// check if the proof-of-work's parameters ensure the target is met,
+// and that the block's stated target is the one the chain expects at its height
+func (pow *ProofOfWork) Validate(chain *BlockChain) bool {
 	var intHash big.Int
 
+	expectedBits, err := chain.CalcNextBits(pow.Block.PrevHash)
+	if err != nil || pow.Block.Bits != expectedBits {
+		return false
+	}
+
+	if pow.Target.Sign() <= 0 || pow.Target.Cmp(chain.PowLimit()) > 0 {
+		return false
+	}
+
 	data := pow.InitData(pow.Block.Nonce)
-	hash := sha256.Sum256(data)
-	intHash.SetBytes(hash[:])
+
+	// the block must be identified by the hash of the header that did the work
+	// whatever the proof's hash function, blocks are always identified by their SHA-256 hash
+	if hash := sha256.Sum256(data); !bytes.Equal(hash[:], pow.Block.Hash) {
+		return false
+	}
+
+	intHash.SetBytes(pow.Hash.Sum(data))
 
 	return intHash.Cmp(pow.Target) == -1
 }
@@ -0,0 +1,373 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+
+	"github.com/dgraph-io/badger"
+)
+
+var (
+	workPrefix = []byte("work-") // cumulative chain work up to and including a block
+	undoPrefix = []byte("undo-") // outputs a block spent, needed to disconnect it again
+)
+
+// an output spent by a block, kept so it can be put back into the UTXO set when the block is disconnected
+type SpentOutput struct {
+	Index    int
+	Output   TransactionOutput
+	Height   int  // height of the block that created the output
+	Coinbase bool // whether the output was created by a coinbase
+}
+
+// everything a block removed from the UTXO set, Spent[i][j] being what the j-th input of the i-th transaction spent
+type BlockUndo struct {
+	Spent [][]SpentOutput
+}
+
+// the amount of hashes that are expected to be needed to meet the given target, 2^256 / (target+1)
+func CalcWork(bits uint32) *big.Int {
+	target := CompactToBig(bits)
+	if target.Sign() <= 0 {
+		return big.NewInt(0)
+	}
+
+	denominator := new(big.Int).Add(target, big.NewInt(1))
+
+	return new(big.Int).Div(new(big.Int).Lsh(big.NewInt(1), 256), denominator)
+}
+
+// errSideBranch aborts the database transaction a block was validated in when its branch doesn't become the best one
+var errSideBranch = errors.New("block is on a lighter branch")
+
+// validate and store the block, making it the chain's tip if its branch carries the most cumulative work
+// blocks on a lighter branch are kept around so they can be switched to once their branch overtakes
+func (chain *BlockChain) AddBlock(block *Block) error {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+
+	// the block is already known
+	if _, err := chain.GetBlock(block.Hash); err == nil {
+		return nil
+	}
+
+	if err := chain.checkBlock(block); err != nil {
+		return err
+	}
+
+	var work *big.Int
+
+	// validating the block means connecting it on top of its branch, which is all that's left to do
+	// when it becomes the tip, so the UTXO set it was validated against is kept then, rather than rebuilt
+	err := chain.Database.Update(func(txn *badger.Txn) error {
+		parentWork, err := getWork(txn, block.PrevHash)
+		if err != nil {
+			return ruleError(ErrMissingParent, "parent %x of block %x is unknown", block.PrevHash, block.Hash)
+		}
+		work = new(big.Int).Add(parentWork, chain.Engine.Work(&block.BlockHeader))
+
+		tip, err := getLastHash(txn)
+		Handle(err)
+		tipWork, err := getWork(txn, tip)
+		Handle(err)
+
+		if err := chain.connectOnBranch(txn, tip, block); err != nil {
+			return err
+		}
+
+		// ties go to the branch that was seen first
+		if work.Cmp(tipWork) <= 0 {
+			return errSideBranch
+		}
+
+		if !bytes.Equal(block.PrevHash, tip) {
+			fmt.Printf("Reorganizing the chain onto the branch ending at %x\n", block.Hash)
+		}
+
+		if err := storeBlock(txn, block, work); err != nil {
+			return err
+		}
+
+		return txn.Set([]byte("lh"), block.Hash)
+	})
+
+	// the block is valid, but only the block itself is kept until its branch overtakes
+	if errors.Is(err, errSideBranch) {
+		return chain.Database.Update(func(txn *badger.Txn) error {
+			return storeBlock(txn, block, work)
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	chain.LastHash = block.Hash
+
+	return nil
+}
+
+// switch the UTXO set from the branch ending at tip to the block's parent, then connect the block on top of it
+func (chain *BlockChain) connectOnBranch(txn *badger.Txn, tip []byte, block *Block) error {
+	if err := chain.reorganize(txn, tip, block.PrevHash); err != nil {
+		return err
+	}
+
+	return chain.connectBlock(txn, block)
+}
+
+// store the block along with the cumulative work of its branch
+func storeBlock(txn *badger.Txn, block *Block, work *big.Int) error {
+	if err := txn.Set(block.Hash, block.Serialize()); err != nil {
+		return err
+	}
+
+	return txn.Set(workKey(block.Hash), work.Bytes())
+}
+
+// switch the UTXO set and the last hash pointer from the branch ending at oldTip to the one ending at newTip
+// blocks only on the old branch are disconnected, and the new branch's blocks are connected from the fork point up
+func (chain *BlockChain) reorganize(txn *badger.Txn, oldTip, newTip []byte) error {
+	var detach, attach []*Block
+
+	oldBlock, err := getBlock(txn, oldTip)
+	if err != nil {
+		return err
+	}
+	newBlock, err := getBlock(txn, newTip)
+	if err != nil {
+		return err
+	}
+
+	// walk both branches back until they meet at the fork point
+	for !bytes.Equal(oldBlock.Hash, newBlock.Hash) {
+		if oldBlock.Height >= newBlock.Height {
+			detach = append(detach, oldBlock)
+			if oldBlock, err = getBlock(txn, oldBlock.PrevHash); err != nil {
+				return err
+			}
+		} else {
+			attach = append(attach, newBlock)
+			if newBlock, err = getBlock(txn, newBlock.PrevHash); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, block := range detach {
+		if err := disconnectBlock(txn, block); err != nil {
+			return err
+		}
+	}
+
+	slices.Reverse(attach)
+	for _, block := range attach {
+		if err := chain.connectBlock(txn, block); err != nil {
+			return err
+		}
+	}
+
+	return txn.Set([]byte("lh"), newTip)
+}
+
+// spend the block's inputs and add its outputs to the UTXO set, remembering what was spent
+// every transaction is checked against the UTXO set as it is being updated, so a RuleError is
+// returned if the block spends missing outputs, spends an output twice, repeats the ID of a
+// transaction with unspent outputs or pays itself too much
+func (chain *BlockChain) connectBlock(txn *badger.Txn, block *Block) error {
+	undo := BlockUndo{}
+	spentInBlock := make(map[string]bool)
+
+	fees := 0
+	coinbaseValue := 0
+
+	// checkpointed blocks are known to be valid, so their signatures may be trusted to speed up syncing
+	// that only goes for blocks known to lead up to the checkpoint, as any other block could be on a forged branch
+	trusted := chain.SkipCheckpointedSignatures && chain.isCheckpointAncestor(block.Hash)
+
+	for _, tx := range block.Transactions {
+		var spent []SpentOutput
+
+		// a transaction with the same ID as one whose outputs are still unspent, such as a copied coinbase,
+		// would overwrite those outputs, and disconnecting the block would then delete them
+		if _, err := getOutputs(txn, tx.ID); err == nil {
+			return ruleError(ErrDuplicateTransaction, "transaction %x in block %x has the same ID as an earlier transaction with unspent outputs", tx.ID, block.Hash)
+		}
+
+		if tx.isCoinbase() {
+			// bounding each output and the total by the maximum supply keeps the total from overflowing
+			for _, out := range tx.Outputs {
+				if out.Value < 0 || out.Value > chain.Params.MaxSupply {
+					return ruleError(ErrBadOutputValue, "coinbase of block %x has an output of %d tokens", block.Hash, out.Value)
+				}
+
+				coinbaseValue += out.Value
+				if coinbaseValue > chain.Params.MaxSupply {
+					return ruleError(ErrBadCoinbaseValue, "coinbase of block %x pays more than the maximum supply of %d tokens", block.Hash, chain.Params.MaxSupply)
+				}
+			}
+		} else {
+			for _, in := range tx.Inputs {
+				outpoint := fmt.Sprintf("%x:%d", in.ID, in.Output)
+				if spentInBlock[outpoint] {
+					return ruleError(ErrDoubleSpend, "output %s is spent more than once in block %x", outpoint, block.Hash)
+				}
+				spentInBlock[outpoint] = true
+			}
+
+			fee, err := chain.checkTransactionInputs(txn, tx, block.Height, block.PrevHash, trusted)
+			if err != nil {
+				return err
+			}
+			fees += fee
+			if fees > chain.Params.MaxSupply {
+				return ruleError(ErrBadCoinbaseValue, "block %x's fees add up to more than the maximum supply of %d tokens", block.Hash, chain.Params.MaxSupply)
+			}
+
+			for _, in := range tx.Inputs {
+				outs, err := getOutputs(txn, in.ID)
+				Handle(err)
+
+				spent = append(spent, SpentOutput{in.Output, outs.Outputs[in.Output], outs.Height, outs.Coinbase})
+				delete(outs.Outputs, in.Output)
+
+				if err := putOutputs(txn, in.ID, outs); err != nil {
+					return err
+				}
+			}
+		}
+
+		undo.Spent = append(undo.Spent, spent)
+
+		newOutputs := TransactionOutputs{make(map[int]TransactionOutput), block.Height, tx.isCoinbase()}
+		for outIdx, out := range tx.Outputs {
+			// data outputs can't be spent, so there's no point keeping track of them
+			if out.ScriptPubKey.IsUnspendable() {
+				continue
+			}
+			newOutputs.Outputs[outIdx] = out
+		}
+
+		if err := putOutputs(txn, tx.ID, newOutputs); err != nil {
+			return err
+		}
+	}
+
+	// the miner may claim the block's subsidy plus whatever the block's transactions left as fees
+	if subsidy := chain.Params.BlockSubsidy(block.Height); coinbaseValue > subsidy+fees {
+		return ruleError(ErrBadCoinbaseValue, "coinbase of block %x pays %d tokens, more than the subsidy of %d plus %d in fees", block.Hash, coinbaseValue, subsidy, fees)
+	}
+
+	return txn.Set(undoKey(block.Hash), undo.Serialize())
+}
+
+// undo connectBlock: remove the block's outputs and put back the outputs it spent
+func disconnectBlock(txn *badger.Txn, block *Block) error {
+	item, err := txn.Get(undoKey(block.Hash))
+	if err != nil {
+		return fmt.Errorf("missing undo data for block %x", block.Hash)
+	}
+	data, err := item.ValueCopy(nil)
+	Handle(err)
+
+	undo := DeserializeUndo(data)
+
+	// go backwards, so outputs created and spent within the block are handled in the right order
+	for txIdx := len(block.Transactions) - 1; txIdx >= 0; txIdx-- {
+		tx := block.Transactions[txIdx]
+
+		if err := txn.Delete(utxoKey(tx.ID)); err != nil {
+			return err
+		}
+
+		for inIdx, spent := range undo.Spent[txIdx] {
+			inID := tx.Inputs[inIdx].ID
+
+			outs, err := getOutputs(txn, inID)
+			if err != nil {
+				outs = TransactionOutputs{make(map[int]TransactionOutput), spent.Height, spent.Coinbase}
+			}
+			outs.Outputs[spent.Index] = spent.Output
+
+			if err := putOutputs(txn, inID, outs); err != nil {
+				return err
+			}
+		}
+	}
+
+	return txn.Delete(undoKey(block.Hash))
+}
+
+func getLastHash(txn *badger.Txn) ([]byte, error) {
+	item, err := txn.Get([]byte("lh"))
+	if err != nil {
+		return nil, err
+	}
+
+	return item.ValueCopy(nil)
+}
+
+func getBlock(txn *badger.Txn, hash []byte) (*Block, error) {
+	item, err := txn.Get(hash)
+	if err != nil {
+		return nil, fmt.Errorf("could not find block %x", hash)
+	}
+
+	var block *Block
+	err = item.Value(func(v []byte) error {
+		block = Deserialize(slices.Clone(v))
+		return nil
+	})
+
+	return block, err
+}
+
+func getWork(txn *badger.Txn, hash []byte) (*big.Int, error) {
+	if len(hash) == 0 {
+		return nil, errors.New("block has no hash")
+	}
+
+	item, err := txn.Get(workKey(hash))
+	if err != nil {
+		return nil, err
+	}
+
+	var work *big.Int
+	err = item.Value(func(v []byte) error {
+		work = new(big.Int).SetBytes(v)
+		return nil
+	})
+
+	return work, err
+}
+
+func workKey(hash []byte) []byte {
+	return append(slices.Clone(workPrefix), hash...)
+}
+
+func undoKey(hash []byte) []byte {
+	return append(slices.Clone(undoPrefix), hash...)
+}
+
+func (undo BlockUndo) Serialize() []byte {
+	var buffer bytes.Buffer
+
+	encode := gob.NewEncoder(&buffer)
+	err := encode.Encode(undo)
+	Handle(err)
+
+	return buffer.Bytes()
+}
+
+func DeserializeUndo(data []byte) BlockUndo {
+	var undo BlockUndo
+
+	decode := gob.NewDecoder(bytes.NewReader(data))
+	err := decode.Decode(&undo)
+	Handle(err)
+
+	return undo
+}
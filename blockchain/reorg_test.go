@@ -0,0 +1,169 @@
+package blockchain
+
+import (
+	"bytes"
+	"golang-blockchain/params"
+	"golang-blockchain/wallet"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger"
+)
+
+// the unspent outputs the UTXO set holds for the transaction
+func unspentOutputs(t *testing.T, chain *BlockChain, txID []byte) TransactionOutputs {
+	t.Helper()
+
+	var outs TransactionOutputs
+	err := chain.Database.View(func(txn *badger.Txn) (err error) {
+		outs, err = getOutputs(txn, txID)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("transaction %x has no unspent outputs: %v", txID, err)
+	}
+
+	return outs
+}
+
+func TestDuplicateCoinbase(t *testing.T) {
+	chain, _ := newTestChain(t, params.RegTest, &fakeClock{time.Now()})
+	genesis := tipBlock(t, chain)
+
+	first := buildBlock(t, chain, genesis, newCoinbase(chain, 1))
+	if err := chain.AddBlock(first); err != nil {
+		t.Fatal(err)
+	}
+	coinbase := first.Transactions[0]
+	original := unspentOutputs(t, chain, coinbase.ID)
+
+	// copying the coinbase byte for byte gives it the same ID, on top of the block holding it as well as further up
+	if err := chain.AddBlock(buildBlock(t, chain, first, coinbase)); ruleErrorCode(t, err) != ErrDuplicateTransaction {
+		t.Fatalf("expected %s, got %v", ErrDuplicateTransaction, err)
+	}
+
+	branch := buildBranch(t, chain, first, 2)
+	if err := chain.AddBlock(branch[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.AddBlock(buildBlock(t, chain, branch[0], coinbase)); ruleErrorCode(t, err) != ErrDuplicateTransaction {
+		t.Fatalf("expected %s, got %v", ErrDuplicateTransaction, err)
+	}
+
+	// the copies never made it into the chain, so switching branches around them leaves the original outputs alone
+	if err := chain.AddBlock(branch[1]); err != nil {
+		t.Fatal(err)
+	}
+	for _, block := range buildBranch(t, chain, first, 3) {
+		if err := chain.AddBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if outs := unspentOutputs(t, chain, coinbase.ID); !reflect.DeepEqual(outs, original) {
+		t.Errorf("the coinbase's outputs changed from %v to %v", original, outs)
+	}
+	checkUTXOSet(t, chain)
+}
+
+// add the blocks to the chain in order, failing the test if one is rejected
+func addBlocks(t *testing.T, chain *BlockChain, blocks ...*Block) {
+	t.Helper()
+
+	for _, block := range blocks {
+		if err := chain.AddBlock(block); err != nil {
+			t.Fatalf("block %d was rejected: %v", block.Height, err)
+		}
+	}
+}
+
+func checkTip(t *testing.T, chain *BlockChain, block *Block) {
+	t.Helper()
+
+	if !bytes.Equal(chain.LastHash, block.Hash) {
+		t.Fatalf("expected block %d on %x to be the tip, got %x", block.Height, block.Hash, chain.LastHash)
+	}
+	checkUTXOSet(t, chain)
+}
+
+// a transaction paying the wallet's outputs to a new wallet
+func newSpend(t *testing.T, chain *BlockChain, w *wallet.Wallet) *Transaction {
+	t.Helper()
+
+	return NewTransaction(w, string(wallet.MakeWallet().Address()), 1, 0, &UTXOSet{chain})
+}
+
+func TestReorganize(t *testing.T) {
+	chain, w := newFundedTestChain(t)
+	fork := tipBlock(t, chain)
+
+	// both branches spend the wallet's only output, each to someone else
+	spendA, spendB := newSpend(t, chain, w), newSpend(t, chain, w)
+
+	a1 := buildBlock(t, chain, fork, newCoinbase(chain, fork.Height+1), spendA)
+	a := append([]*Block{a1}, buildBranch(t, chain, a1, 3)...)
+	b1 := buildBlock(t, chain, fork, newCoinbase(chain, fork.Height+1), spendB)
+	b := append([]*Block{b1}, buildBranch(t, chain, b1, 2)...)
+
+	addBlocks(t, chain, a[:2]...)
+	checkTip(t, chain, a[1])
+
+	// as heavy as the tip, which was seen first
+	addBlocks(t, chain, b[:2]...)
+	checkTip(t, chain, a[1])
+
+	addBlocks(t, chain, b[2])
+	checkTip(t, chain, b[2])
+	if _, err := chain.FindTransaction(spendA.ID); err == nil {
+		t.Error("the disconnected branch's transaction is still in the chain")
+	}
+
+	addBlocks(t, chain, a[2:]...)
+	checkTip(t, chain, a[3])
+	if _, err := chain.FindTransaction(spendB.ID); err == nil {
+		t.Error("the disconnected branch's transaction is still in the chain")
+	}
+}
+
+func TestReorganizeOntoInvalidBranch(t *testing.T) {
+	chain, w := newFundedTestChain(t)
+	fork := tipBlock(t, chain)
+
+	a := buildBranch(t, chain, fork, 2)
+	addBlocks(t, chain, a...)
+
+	// the side branch spends the wallet's output, then spends it again in the block that would make it the heaviest
+	b1 := buildBlock(t, chain, fork, newCoinbase(chain, fork.Height+1), newSpend(t, chain, w))
+	b2 := buildBranch(t, chain, b1, 1)[0]
+	addBlocks(t, chain, b1, b2)
+
+	tests := []struct {
+		name  string
+		block *Block
+		err   ErrorCode
+	}{
+		{"spending an output spent earlier on the branch", buildBlock(t, chain, b2, newCoinbase(chain, b2.Height+1), newSpend(t, chain, w)), ErrMissingInput},
+		{"paying itself too much", buildBlock(t, chain, b2, CoinbaseTx(string(w.Address()), "", chain.Params.BlockSubsidy(b2.Height+1)+1)), ErrBadCoinbaseValue},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if code := ruleErrorCode(t, chain.AddBlock(test.block)); code != test.err {
+				t.Fatalf("expected %s, got %s", test.err, code)
+			}
+
+			if _, err := chain.GetBlock(test.block.Hash); err == nil {
+				t.Error("the invalid block was stored")
+			}
+			checkTip(t, chain, a[1])
+
+			// blocks built on top of it have nothing to connect to
+			child := buildBranch(t, chain, test.block, 1)[0]
+			if code := ruleErrorCode(t, chain.AddBlock(child)); code != ErrMissingParent {
+				t.Fatalf("expected %s, got %s", ErrMissingParent, code)
+			}
+			checkTip(t, chain, a[1])
+		})
+	}
+}
@@ -0,0 +1,549 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// a program in a small stack based language, as in Bitcoin
+// an output's ScriptPubKey sets the conditions for spending it, and the spending input's ScriptSig
+// pushes the data meeting them; the output can be spent if running both leaves a true value on the stack
+type Script []byte
+
+// the opcodes keep Bitcoin's values
+const (
+	OP_0         = 0x00 // push an empty array, which counts as false
+	OP_PUSHDATA1 = 0x4c // push the number of bytes given by the next byte
+	OP_PUSHDATA2 = 0x4d // push the number of bytes given by the next 2 bytes, little endian
+	OP_PUSHDATA4 = 0x4e // push the number of bytes given by the next 4 bytes, little endian
+	OP_1NEGATE   = 0x4f
+	OP_1         = 0x51 // OP_1 to OP_16 push the numbers 1 to 16
+	OP_16        = 0x60
+	OP_NOP       = 0x61
+
+	// flow control
+	OP_IF     = 0x63
+	OP_NOTIF  = 0x64
+	OP_ELSE   = 0x67
+	OP_ENDIF  = 0x68
+	OP_VERIFY = 0x69
+	OP_RETURN = 0x6a
+
+	// stack
+	OP_DROP = 0x75
+	OP_DUP  = 0x76
+	OP_NIP  = 0x77
+	OP_OVER = 0x78
+	OP_SWAP = 0x7c
+	OP_SIZE = 0x82
+
+	// comparison
+	OP_EQUAL       = 0x87
+	OP_EQUALVERIFY = 0x88
+
+	// crypto
+	OP_SHA256              = 0xa8
+	OP_HASH160             = 0xa9 // RIPEMD-160 of the SHA-256, as addresses are made of
+	OP_HASH256             = 0xaa // SHA-256 twice
+	OP_CHECKSIG            = 0xac
+	OP_CHECKSIGVERIFY      = 0xad
+	OP_CHECKMULTISIG       = 0xae
+	OP_CHECKMULTISIGVERIFY = 0xaf
+
+	// locktime
+	OP_CHECKLOCKTIMEVERIFY = 0xb1 // fail unless the spending transaction's lock time is at least the number on top of the stack
+	OP_CHECKSEQUENCEVERIFY = 0xb2 // fail unless the spending input's relative lock time is at least the number on top of the stack
+)
+
+// data pushes are made of 1 to 75 bytes following the opcode giving their length
+const maxDirectPush = 0x4b
+
+var opcodeNames = map[byte]string{
+	OP_0:                   "OP_0",
+	OP_PUSHDATA1:           "OP_PUSHDATA1",
+	OP_PUSHDATA2:           "OP_PUSHDATA2",
+	OP_PUSHDATA4:           "OP_PUSHDATA4",
+	OP_1NEGATE:             "OP_1NEGATE",
+	OP_NOP:                 "OP_NOP",
+	OP_IF:                  "OP_IF",
+	OP_NOTIF:               "OP_NOTIF",
+	OP_ELSE:                "OP_ELSE",
+	OP_ENDIF:               "OP_ENDIF",
+	OP_VERIFY:              "OP_VERIFY",
+	OP_RETURN:              "OP_RETURN",
+	OP_DROP:                "OP_DROP",
+	OP_DUP:                 "OP_DUP",
+	OP_NIP:                 "OP_NIP",
+	OP_OVER:                "OP_OVER",
+	OP_SWAP:                "OP_SWAP",
+	OP_SIZE:                "OP_SIZE",
+	OP_EQUAL:               "OP_EQUAL",
+	OP_EQUALVERIFY:         "OP_EQUALVERIFY",
+	OP_SHA256:              "OP_SHA256",
+	OP_HASH160:             "OP_HASH160",
+	OP_HASH256:             "OP_HASH256",
+	OP_CHECKSIG:            "OP_CHECKSIG",
+	OP_CHECKSIGVERIFY:      "OP_CHECKSIGVERIFY",
+	OP_CHECKMULTISIG:       "OP_CHECKMULTISIG",
+	OP_CHECKMULTISIGVERIFY: "OP_CHECKMULTISIGVERIFY",
+	OP_CHECKLOCKTIMEVERIFY: "OP_CHECKLOCKTIMEVERIFY",
+	OP_CHECKSEQUENCEVERIFY: "OP_CHECKSEQUENCEVERIFY",
+}
+
+var errMalformedScript = errors.New("malformed script")
+
+// a single opcode of a script, along with the data it pushes, if any
+type instruction struct {
+	op   byte
+	data []byte
+}
+
+// append an opcode to the script
+func (s Script) AddOp(op byte) Script {
+	return append(s, op)
+}
+
+// append the shortest push of data to the script
+func (s Script) AddData(data []byte) Script {
+	switch n := len(data); {
+	case n == 0:
+		return append(s, OP_0)
+	case n <= maxDirectPush:
+		s = append(s, byte(n))
+	case n <= 0xff:
+		s = append(s, OP_PUSHDATA1, byte(n))
+	case n <= 0xffff:
+		s = append(s, OP_PUSHDATA2)
+		s = binary.LittleEndian.AppendUint16(s, uint16(n))
+	default:
+		s = append(s, OP_PUSHDATA4)
+		s = binary.LittleEndian.AppendUint32(s, uint32(n))
+	}
+
+	return append(s, data...)
+}
+
+// append a push of the number to the script, using the small number opcodes where there is one
+func (s Script) AddInt(n int64) Script {
+	switch {
+	case n == 0:
+		return append(s, OP_0)
+	case n == -1:
+		return append(s, OP_1NEGATE)
+	case n >= 1 && n <= 16:
+		return append(s, byte(OP_1+n-1))
+	}
+
+	return s.AddData(encodeNum(n))
+}
+
+// split the script into its instructions
+func (s Script) parse() ([]instruction, error) {
+	var instructions []instruction
+
+	for i := 0; i < len(s); {
+		op := s[i]
+		i++
+
+		var size int
+		switch {
+		case op >= 0x01 && op <= maxDirectPush:
+			size = int(op)
+		case op == OP_PUSHDATA1:
+			if i+1 > len(s) {
+				return nil, errMalformedScript
+			}
+			size = int(s[i])
+			i++
+		case op == OP_PUSHDATA2:
+			if i+2 > len(s) {
+				return nil, errMalformedScript
+			}
+			size = int(binary.LittleEndian.Uint16(s[i:]))
+			i += 2
+		case op == OP_PUSHDATA4:
+			if i+4 > len(s) {
+				return nil, errMalformedScript
+			}
+			size = int(binary.LittleEndian.Uint32(s[i:]))
+			i += 4
+		default:
+			instructions = append(instructions, instruction{op, nil})
+			continue
+		}
+
+		if size < 0 || i+size > len(s) {
+			return nil, errMalformedScript
+		}
+
+		instructions = append(instructions, instruction{op, s[i : i+size]})
+		i += size
+	}
+
+	return instructions, nil
+}
+
+// whether the script does nothing but push data, as unlocking scripts must
+func (s Script) IsPushOnly() bool {
+	instructions, err := s.parse()
+	if err != nil {
+		return false
+	}
+
+	for _, in := range instructions {
+		if !isPush(in.op) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// the data the script pushes, if it does nothing else
+func (s Script) PushedData() ([][]byte, bool) {
+	if !s.IsPushOnly() {
+		return nil, false
+	}
+
+	instructions, _ := s.parse()
+
+	var data [][]byte
+	for _, in := range instructions {
+		data = append(data, in.pushed())
+	}
+
+	return data, true
+}
+
+// whether the opcode only pushes data or a number
+func isPush(op byte) bool {
+	return op <= OP_PUSHDATA4 || op == OP_1NEGATE || (op >= OP_1 && op <= OP_16)
+}
+
+// what a push-only instruction puts on the stack
+func (in instruction) pushed() []byte {
+	switch {
+	case in.op == OP_1NEGATE:
+		return encodeNum(-1)
+	case in.op >= OP_1 && in.op <= OP_16:
+		return encodeNum(int64(in.op - OP_1 + 1))
+	}
+
+	return in.data
+}
+
+// the script in a human readable form, with data pushes in hex
+func (s Script) String() string {
+	instructions, err := s.parse()
+	if err != nil {
+		return fmt.Sprintf("[malformed script %x]", []byte(s))
+	}
+
+	var words []string
+	for _, in := range instructions {
+		switch {
+		case in.op == OP_0:
+			words = append(words, "OP_0")
+		case in.op <= OP_PUSHDATA4:
+			words = append(words, hex.EncodeToString(in.data))
+		case in.op >= OP_1 && in.op <= OP_16:
+			words = append(words, fmt.Sprintf("OP_%d", in.op-OP_1+1))
+		case opcodeNames[in.op] != "":
+			words = append(words, opcodeNames[in.op])
+		default:
+			words = append(words, fmt.Sprintf("OP_UNKNOWN%d", in.op))
+		}
+	}
+
+	return strings.Join(words, " ")
+}
+
+// numbers are little endian, with the sign in the most significant bit, and as short as possible
+// zero is the empty array
+func encodeNum(n int64) []byte {
+	if n == 0 {
+		return nil
+	}
+
+	negative := n < 0
+	magnitude := uint64(n)
+	if negative {
+		magnitude = uint64(-n)
+	}
+
+	var result []byte
+	for magnitude > 0 {
+		result = append(result, byte(magnitude))
+		magnitude >>= 8
+	}
+
+	// the sign needs a byte of its own if the most significant one already has its top bit set
+	if result[len(result)-1]&0x80 != 0 {
+		if negative {
+			result = append(result, 0x80)
+		} else {
+			result = append(result, 0x00)
+		}
+	} else if negative {
+		result[len(result)-1] |= 0x80
+	}
+
+	return result
+}
+
+// the inverse of encodeNum, for numbers of at most maxSize bytes, which have to be encoded as encodeNum does
+func decodeNum(data []byte, maxSize int) (int64, error) {
+	if len(data) > maxSize {
+		return 0, fmt.Errorf("number of %d bytes is more than the limit of %d", len(data), maxSize)
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	// anything longer than encodeNum makes it would let the same number be pushed in different ways
+	last := len(data) - 1
+	if data[last]&0x7f == 0 && (last == 0 || data[last-1]&0x80 == 0) {
+		return 0, errors.New("number isn't minimally encoded")
+	}
+
+	var n int64
+	for i, b := range data {
+		n |= int64(b) << (8 * i)
+	}
+
+	// clear the sign bit, then apply it
+	if data[last]&0x80 != 0 {
+		n &^= int64(0x80) << (8 * last)
+		n = -n
+	}
+
+	return n, nil
+}
+
+// the standard script locking an output to the owner of the public key hash, pay-to-public-key-hash:
+// the spender has to push a public key hashing to it and a signature made with it
+func P2PKHScript(publicKeyHash []byte) Script {
+	return Script{}.
+		AddOp(OP_DUP).
+		AddOp(OP_HASH160).
+		AddData(publicKeyHash).
+		AddOp(OP_EQUALVERIFY).
+		AddOp(OP_CHECKSIG)
+}
+
+// the unlocking script spending a pay-to-public-key-hash output
+func P2PKHScriptSig(signature, publicKey []byte) Script {
+	return Script{}.AddData(signature).AddData(publicKey)
+}
+
+// the public key hash the script pays to, if it's a standard pay-to-public-key-hash script
+func (s Script) PublicKeyHash() ([]byte, bool) {
+	if len(s) != 25 || !bytes.Equal(s, P2PKHScript(s[3:23])) {
+		return nil, false
+	}
+
+	return s[3:23], true
+}
+
+// the standard script locking an output to the hash of another script, pay-to-script-hash:
+// the spender has to push the script, which is then run on the rest of what they pushed
+func P2SHScript(scriptHash []byte) Script {
+	return Script{}.
+		AddOp(OP_HASH160).
+		AddData(scriptHash).
+		AddOp(OP_EQUAL)
+}
+
+// the script hash the script pays to, if it's a standard pay-to-script-hash script
+func (s Script) ScriptHash() ([]byte, bool) {
+	if len(s) != 23 || !bytes.Equal(s, P2SHScript(s[2:22])) {
+		return nil, false
+	}
+
+	return s[2:22], true
+}
+
+// the standard script of a data output, which carries the data rather than locking tokens
+// as it starts with OP_RETURN, nothing can ever spend it, so nodes leave it out of the UTXO set
+func DataScript(data []byte) Script {
+	return Script{}.
+		AddOp(OP_RETURN).
+		AddData(data)
+}
+
+// the data the script carries, if it's a standard data script
+func (s Script) Data() ([]byte, bool) {
+	if !s.IsUnspendable() {
+		return nil, false
+	}
+
+	pushed, ok := s[1:].PushedData()
+	if !ok || len(pushed) != 1 || !bytes.Equal(s, DataScript(pushed[0])) {
+		return nil, false
+	}
+
+	return pushed[0], true
+}
+
+// whether no unlocking script can ever spend an output locked with the script, as running it starts with OP_RETURN
+func (s Script) IsUnspendable() bool {
+	return len(s) > 0 && s[0] == OP_RETURN
+}
+
+// the standard script locking an output to m of the public keys, which can be the output's script itself, bare multisig,
+// or be hidden behind a pay-to-script-hash one
+// spending it takes signatures made with m of the keys, pushed in the same order as the keys
+// spending by its hash takes pushing the script, so it's kept within MaxScriptElementSize, which with 64 byte keys
+// leaves room for 7 of them rather than MaxMultisigKeys
+func MultisigScript(m int, publicKeys [][]byte) (Script, error) {
+	if len(publicKeys) < 1 || len(publicKeys) > MaxMultisigKeys {
+		return nil, fmt.Errorf("a multisig script takes between 1 and %d public keys", MaxMultisigKeys)
+	}
+	if m < 1 || m > len(publicKeys) {
+		return nil, fmt.Errorf("a multisig script can't require %d of %d signatures", m, len(publicKeys))
+	}
+
+	script := Script{}.AddInt(int64(m))
+	for _, publicKey := range publicKeys {
+		if len(publicKey) != 64 {
+			return nil, fmt.Errorf("public key %x isn't 64 bytes", publicKey)
+		}
+		script = script.AddData(publicKey)
+	}
+
+	script = script.AddInt(int64(len(publicKeys))).AddOp(OP_CHECKMULTISIG)
+
+	// otherwise tokens sent to the script's address could never be spent
+	if len(script) > MaxScriptElementSize {
+		return nil, fmt.Errorf("a multisig script of %d public keys takes %d bytes, more than the %d a spender can push", len(publicKeys), len(script), MaxScriptElementSize)
+	}
+
+	return script, nil
+}
+
+// the number of signatures required and the public keys, if it's a standard multisig script
+func (s Script) Multisig() (int, [][]byte, bool) {
+	instructions, err := s.parse()
+	if err != nil || len(instructions) < 4 || instructions[len(instructions)-1].op != OP_CHECKMULTISIG {
+		return 0, nil, false
+	}
+
+	var publicKeys [][]byte
+	for _, in := range instructions[1 : len(instructions)-2] {
+		if in.op > OP_PUSHDATA4 || len(in.data) != 64 {
+			return 0, nil, false
+		}
+		publicKeys = append(publicKeys, in.data)
+	}
+
+	m, errM := decodeNum(instructions[0].pushed(), 4)
+	n, errN := decodeNum(instructions[len(instructions)-2].pushed(), 4)
+	if !isPush(instructions[0].op) || !isPush(instructions[len(instructions)-2].op) || errM != nil || errN != nil {
+		return 0, nil, false
+	}
+	if int(n) != len(publicKeys) || m < 1 || m > n {
+		return 0, nil, false
+	}
+
+	// only scripts as MultisigScript builds them count as standard
+	if standard, err := MultisigScript(int(m), publicKeys); err != nil || !bytes.Equal(s, standard) {
+		return 0, nil, false
+	}
+
+	return int(m), publicKeys, true
+}
+
+// the unlocking script spending a multisig output, pushing the signatures in the order of their keys
+// spending a pay-to-script-hash output also takes pushing the multisig script, which is left nil for bare multisig
+func MultisigScriptSig(signatures [][]byte, redeemScript Script) Script {
+	script := Script{}
+	for _, signature := range signatures {
+		script = script.AddData(signature)
+	}
+
+	if redeemScript != nil {
+		script = script.AddData(redeemScript)
+	}
+
+	return script
+}
+
+// the standard script vesting an output: it's locked to the owner of the public key hash, who can't spend it
+// before the height, or unix time, lockTime, as they have to set the spending transaction's lock time to at least that
+func VestingScript(lockTime uint32, publicKeyHash []byte) Script {
+	return append(Script{}.
+		AddInt(int64(lockTime)).
+		AddOp(OP_CHECKLOCKTIMEVERIFY).
+		AddOp(OP_DROP), P2PKHScript(publicKeyHash)...)
+}
+
+// the lock time and public key hash of the script, if it's a standard vesting script
+func (s Script) Vesting() (uint32, []byte, bool) {
+	instructions, err := s.parse()
+	if err != nil || len(instructions) != 8 || !isPush(instructions[0].op) {
+		return 0, nil, false
+	}
+
+	lockTime, err := decodeNum(instructions[0].pushed(), 5)
+	if err != nil || lockTime < 0 || lockTime > 0xffffffff {
+		return 0, nil, false
+	}
+
+	publicKeyHash := instructions[5].data
+	if !bytes.Equal(s, VestingScript(uint32(lockTime), publicKeyHash)) {
+		return 0, nil, false
+	}
+
+	return uint32(lockTime), publicKeyHash, true
+}
+
+// the standard script of a hash time-locked contract: the recipient can spend the output by revealing
+// the 32 byte secret hashing to secretHash, and once the chain is past lockTime, the sender can take it back
+// nothing stops the recipient from redeeming after lockTime, but the sender may refund first from then on
+func HTLCScript(secretHash, recipient, refund []byte, lockTime uint32) Script {
+	return Script{}.
+		AddOp(OP_IF).
+		AddOp(OP_SIZE).AddInt(32).AddOp(OP_EQUALVERIFY).
+		AddOp(OP_SHA256).AddData(secretHash).AddOp(OP_EQUALVERIFY).
+		AddOp(OP_DUP).AddOp(OP_HASH160).AddData(recipient).
+		AddOp(OP_ELSE).
+		AddInt(int64(lockTime)).AddOp(OP_CHECKLOCKTIMEVERIFY).AddOp(OP_DROP).
+		AddOp(OP_DUP).AddOp(OP_HASH160).AddData(refund).
+		AddOp(OP_ENDIF).
+		AddOp(OP_EQUALVERIFY).
+		AddOp(OP_CHECKSIG)
+}
+
+// the secret hash, recipient and refund public key hashes and lock time of the script, if it's a standard HTLC script
+func (s Script) HTLC() ([]byte, []byte, []byte, uint32, bool) {
+	instructions, err := s.parse()
+	if err != nil || len(instructions) != 20 || !isPush(instructions[11].op) {
+		return nil, nil, nil, 0, false
+	}
+
+	lockTime, err := decodeNum(instructions[11].pushed(), 5)
+	if err != nil || lockTime < 0 || lockTime > 0xffffffff {
+		return nil, nil, nil, 0, false
+	}
+
+	secretHash, recipient, refund := instructions[5].data, instructions[9].data, instructions[16].data
+	if !bytes.Equal(s, HTLCScript(secretHash, recipient, refund, uint32(lockTime))) {
+		return nil, nil, nil, 0, false
+	}
+
+	return secretHash, recipient, refund, uint32(lockTime), true
+}
+
+// the unlocking script redeeming a pay-to-script-hash HTLC output with the secret
+func HTLCRedeemScriptSig(signature, publicKey, secret []byte, contract Script) Script {
+	return Script{}.AddData(signature).AddData(publicKey).AddData(secret).AddInt(1).AddData(contract)
+}
+
+// the unlocking script refunding a pay-to-script-hash HTLC output, once its lock time passed
+func HTLCRefundScriptSig(signature, publicKey []byte, contract Script) Script {
+	return Script{}.AddData(signature).AddData(publicKey).AddInt(0).AddData(contract)
+}
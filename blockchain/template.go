@@ -0,0 +1,192 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/dgraph-io/badger"
+)
+
+// room kept in a block for its header, its coinbase and the encoding's overhead while picking transactions
+const blockReserve = 4096
+
+// everything a miner needs to build the next block on top of the chain's tip
+// the miner adds a coinbase claiming CoinbaseValue, seals the block, and submits it back
+type BlockTemplate struct {
+	Engine        string         `json:"engine"` // the consensus engine the block has to be sealed for
+	Version       int            `json:"version"`
+	PrevHash      []byte         `json:"prevHash"`
+	Height        int            `json:"height"`
+	Bits          uint32         `json:"bits"`
+	Target        string         `json:"target"`    // hex encoded target the block's hash must meet, for proof-of-work
+	Timestamp     int64          `json:"timestamp"` // the current time, or MinTime if our clock is behind
+	MinTime       int64          `json:"minTime"`   // the earliest timestamp the block may carry
+	CoinbaseValue int            `json:"coinbaseValue"`
+	Fees          int            `json:"fees"`
+	Transactions  []*Transaction `json:"transactions"` // the transactions to include after the coinbase
+}
+
+// build a template on top of the chain's tip out of the candidate transactions
+// candidates that are invalid, conflict with one picked before them or don't fit in the block anymore are left out
+func (chain *BlockChain) NewBlockTemplate(candidates []*Transaction) (*BlockTemplate, error) {
+	var tip *Block
+
+	err := chain.Database.View(func(txn *badger.Txn) error {
+		lastHash, err := getLastHash(txn)
+		if err != nil {
+			return err
+		}
+
+		tip, err = getBlock(txn, lastHash)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the timestamp has to be after the median time past, even if our clock is behind
+	medianTime, err := chain.CalcPastMedianTime(tip.Hash)
+	if err != nil {
+		return nil, err
+	}
+	minTime := medianTime + 1
+
+	version, err := chain.CalcNextBlockVersion(tip.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	header := BlockHeader{Version: version, PrevHash: tip.Hash, Timestamp: max(chain.now().Unix(), minTime), Height: tip.Height + 1}
+	if err := chain.Engine.Prepare(chain, &header); err != nil {
+		return nil, err
+	}
+
+	template := &BlockTemplate{
+		Engine:    engineName(chain.Engine),
+		Version:   header.Version,
+		PrevHash:  header.PrevHash,
+		Height:    header.Height,
+		Bits:      header.Bits,
+		Target:    fmt.Sprintf("%064x", CompactToBig(header.Bits)),
+		Timestamp: header.Timestamp,
+		MinTime:   minTime,
+	}
+
+	// outputs already spent by a transaction picked for this block, so conflicting ones are left out
+	spent := make(map[string]bool)
+
+	// transactions are picked until the block is full
+	size := blockReserve
+
+Candidates:
+	for _, tx := range candidates {
+		fee, err := chain.ValidateTransaction(tx)
+		if err != nil {
+			fmt.Printf("Skipping transaction %x: %s\n", tx.ID, err)
+			continue
+		}
+
+		for _, in := range tx.Inputs {
+			if spent[fmt.Sprintf("%x:%d", in.ID, in.Output)] {
+				continue Candidates
+			}
+		}
+
+		txSize := len(tx.Serialize())
+		if size+txSize > chain.Params.MaxBlockSize {
+			continue
+		}
+		size += txSize
+
+		for _, in := range tx.Inputs {
+			spent[fmt.Sprintf("%x:%d", in.ID, in.Output)] = true
+		}
+
+		template.Transactions = append(template.Transactions, tx)
+		template.Fees += fee
+	}
+
+	// the coinbase may claim the subsidy along with every picked transaction's fee
+	template.CoinbaseValue = chain.Params.BlockSubsidy(template.Height) + template.Fees
+
+	return template, nil
+}
+
+// assemble the unsealed block the template describes, with the given coinbase first
+func (template *BlockTemplate) NewBlock(coinbase *Transaction) *Block {
+	return template.newBlock(append([]*Transaction{coinbase}, template.Transactions...))
+}
+
+func (template *BlockTemplate) newBlock(transactions []*Transaction) *Block {
+	header := BlockHeader{
+		Version:   template.Version,
+		PrevHash:  template.PrevHash,
+		Timestamp: template.Timestamp,
+		Bits:      template.Bits,
+		Height:    template.Height,
+	}
+
+	block := &Block{header, []byte{}, transactions}
+	block.MerkleRoot = block.HashTransactions()
+
+	return block
+}
+
+// the proof-of-work a miner has to do for a block built from the template
+func (template *BlockTemplate) Proof(block *Block) (*ProofOfWork, error) {
+	hash, err := EngineHash(template.Engine)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewProofWithHash(block, hash), nil
+}
+
+// the hash blocks of chains running the given engine are mined with
+func EngineHash(engine string) (PowHash, error) {
+	switch engine {
+	case EnginePow:
+		return SHA256Hash, nil
+	case EngineScrypt:
+		return ScryptHash, nil
+	}
+
+	return PowHash{}, fmt.Errorf("blocks of %s chains can't be mined", engine)
+}
+
+// seal the block with the chain's engine and add it to the chain
+// returns ErrStaleTip, along with the block, if another block took the tip while sealing
+func (chain *BlockChain) SealBlock(ctx context.Context, block *Block) (*Block, error) {
+	if err := chain.Engine.Seal(ctx, chain, block); err != nil {
+		return nil, err
+	}
+
+	return block, chain.SubmitBlock(block)
+}
+
+// add a block sealed from a template to the chain
+// returns ErrStaleTip if the block is valid but didn't become the chain's tip
+func (chain *BlockChain) SubmitBlock(block *Block) error {
+	if err := chain.AddBlock(block); err != nil {
+		return err
+	}
+
+	// someone else extended the chain while the block was being sealed, so it only made it onto a side branch
+	if !bytes.Equal(chain.LastHash, block.Hash) {
+		return ErrStaleTip
+	}
+
+	return nil
+}
+
+func engineName(engine ConsensusEngine) string {
+	switch engine.(type) {
+	case ScryptEngine:
+		return EngineScrypt
+	case *PoaEngine:
+		return EnginePoa
+	}
+
+	return EnginePow
+}
@@ -0,0 +1,144 @@
+package blockchain
+
+import (
+	"github.com/dgraph-io/badger"
+)
+
+// lock times, as in Bitcoin
+// a transaction's LockTime is the height, or the unix time, it can't be mined before, which is measured
+// against the median time past of the block's parent rather than its own timestamp, so miners can't lie about it
+// an input's Sequence is a relative lock time instead: the number of blocks, or of 512 second units,
+// that must pass after the block holding the output it spends before it can be spent
+const (
+	LockTimeThreshold = 500000000 // lock times below are heights, the others unix times
+
+	SequenceFinal               = 0xffffffff // an input with this sequence opts out of the transaction's lock time
+	SequenceLockTimeDisableFlag = 1 << 31    // set when the input has no relative lock time
+	SequenceLockTimeTypeFlag    = 1 << 22    // set when the relative lock time counts 512 second units rather than blocks
+	SequenceLockTimeMask        = 0x0000ffff // the bits of the sequence holding the relative lock time
+	SequenceLockTimeGranularity = 9          // relative lock times in seconds are shifted by this many bits
+)
+
+// whether the lock time has passed for a block at the given height, whose parent has the given median time past
+func lockTimeReached(lockTime uint32, height int, medianTime int64) bool {
+	if lockTime < LockTimeThreshold {
+		return int64(lockTime) < int64(height)
+	}
+
+	return int64(lockTime) < medianTime
+}
+
+// whether the transaction may be mined in a block at the given height, whose parent has the given median time past
+// a lock time of zero, or inputs that all opted out, leave the transaction free to be mined at any time
+func (tx *Transaction) isFinal(height int, medianTime int64) bool {
+	if tx.LockTime == 0 || lockTimeReached(tx.LockTime, height, medianTime) {
+		return true
+	}
+
+	for _, in := range tx.Inputs {
+		if in.Sequence != SequenceFinal {
+			return false
+		}
+	}
+
+	return true
+}
+
+// check the transaction's lock time allows it into a block at the given height, on top of prevHash
+func (chain *BlockChain) checkLockTime(tx *Transaction, height int, prevHash []byte) error {
+	var medianTime int64
+	if tx.LockTime >= LockTimeThreshold {
+		var err error
+		if medianTime, err = chain.CalcPastMedianTime(prevHash); err != nil {
+			return err
+		}
+	}
+
+	if !tx.isFinal(height, medianTime) {
+		return ruleError(ErrNonFinalTransaction, "transaction %x is locked until %d", tx.ID, tx.LockTime)
+	}
+
+	return nil
+}
+
+// check the input's relative lock time allows spending the output created at outputHeight in a block at the given height, on top of prevHash
+func (chain *BlockChain) checkSequenceLock(txn *badger.Txn, tx *Transaction, input, outputHeight, height int, prevHash []byte) error {
+	sequence := tx.Inputs[input].Sequence
+	if sequence&SequenceLockTimeDisableFlag != 0 {
+		return nil
+	}
+
+	value := int64(sequence & SequenceLockTimeMask)
+
+	if sequence&SequenceLockTimeTypeFlag == 0 {
+		if int64(height-outputHeight) < value {
+			return ruleError(ErrSequenceLockNotMet, "transaction %x's input %d can't be spent for %d blocks after height %d", tx.ID, input, value, outputHeight)
+		}
+		return nil
+	}
+
+	// time passes from the median time past of the block before the output's, as it's the latest its creation could be told apart from
+	parent, err := getBlock(txn, prevHash)
+	if err != nil {
+		return err
+	}
+	before, err := chain.ancestor(parent, outputHeight-1)
+	if err != nil {
+		return err
+	}
+
+	outputTime := int64(0)
+	if before != nil {
+		if outputTime, err = chain.CalcPastMedianTime(before); err != nil {
+			return err
+		}
+	}
+
+	medianTime, err := chain.CalcPastMedianTime(prevHash)
+	if err != nil {
+		return err
+	}
+
+	if medianTime-outputTime < value<<SequenceLockTimeGranularity {
+		return ruleError(ErrSequenceLockNotMet, "transaction %x's input %d can't be spent for %d seconds after time %d", tx.ID, input, value<<SequenceLockTimeGranularity, outputTime)
+	}
+
+	return nil
+}
+
+// the checks OP_CHECKLOCKTIMEVERIFY and OP_CHECKSEQUENCEVERIFY make against the spending transaction
+
+func (checker *txSignatureChecker) CheckLockTime(lockTime int64) bool {
+	txLockTime := int64(checker.tx.LockTime)
+
+	// heights and times can't be compared
+	if (lockTime < LockTimeThreshold) != (txLockTime < LockTimeThreshold) {
+		return false
+	}
+
+	if lockTime > txLockTime {
+		return false
+	}
+
+	// an input opting out would let the transaction be mined regardless of its lock time
+	return checker.tx.Inputs[checker.input].Sequence != SequenceFinal
+}
+
+func (checker *txSignatureChecker) CheckSequence(sequence int64) bool {
+	txSequence := int64(checker.tx.Inputs[checker.input].Sequence)
+
+	if txSequence&SequenceLockTimeDisableFlag != 0 {
+		return false
+	}
+
+	mask := int64(SequenceLockTimeTypeFlag | SequenceLockTimeMask)
+	sequence &= mask
+	txSequence &= mask
+
+	// blocks and times can't be compared
+	if (sequence < SequenceLockTimeTypeFlag) != (txSequence < SequenceLockTimeTypeFlag) {
+		return false
+	}
+
+	return sequence <= txSequence
+}
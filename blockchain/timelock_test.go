@@ -0,0 +1,78 @@
+package blockchain
+
+import (
+	"golang-blockchain/wallet"
+	"testing"
+)
+
+// mine blocks until the next one is at the given height
+func generateUntil(t *testing.T, chain *BlockChain, height int) {
+	t.Helper()
+
+	if _, err := chain.GenerateBlocks(height-chain.GetBestHeight()-1, string(wallet.MakeWallet().Address())); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// a transaction spending the first output of prev, signed by the wallet, with the given lock time and sequence
+func spendWithLock(chain *BlockChain, w *wallet.Wallet, prev *Transaction, lockTime, sequence uint32) *Transaction {
+	to := string(wallet.MakeWallet().Address())
+	tx := Transaction{nil, []TransactionInput{{prev.ID, 0, nil, sequence}}, []TransactionOutput{*NewTransactionOutput(prev.Outputs[0].Value, to)}, lockTime}
+	tx.ID = tx.hash()
+	chain.SignTransaction(&tx, w.PrivateKey)
+
+	return &tx
+}
+
+func TestCheckLockTimeVerify(t *testing.T) {
+	chain, w := newFundedTestChain(t)
+	owner := wallet.MakeWallet()
+
+	// the tranche vests once the chain is past lockTime, so it can go in the block after it
+	lockTime := uint32(chain.GetBestHeight() + 5)
+	vesting, err := NewVestingTransaction(w, string(owner.Address()), 10, 0, []uint32{lockTime}, &UTXOSet{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mineTransactions(t, chain, vesting)
+
+	generateUntil(t, chain, int(lockTime))
+
+	// one block early, the transaction's own lock time isn't past yet
+	rejectTransactions(t, chain, ErrNonFinalTransaction, spendWithLock(chain, owner, vesting, lockTime, 0))
+
+	// and a transaction final one block early doesn't meet the script's lock time
+	rejectTransactions(t, chain, ErrBadSignature, spendWithLock(chain, owner, vesting, lockTime-1, 0))
+
+	generateUntil(t, chain, int(lockTime)+1)
+
+	claim, err := NewClaimTransaction(owner, 0, &UTXOSet{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mineTransactions(t, chain, claim)
+}
+
+func TestCheckSequenceVerify(t *testing.T) {
+	chain, w := newFundedTestChain(t)
+	owner := wallet.MakeWallet()
+
+	// spendable by the owner once the output is buried under that many blocks
+	const delay = 3
+	script := append(Script{}.AddInt(delay).AddOp(OP_CHECKSEQUENCEVERIFY).AddOp(OP_DROP), P2PKHScript(wallet.PublicKeyHash(owner.PublicKey))...)
+
+	locked := NewScriptTransaction(w, script, 10, 0, &UTXOSet{chain})
+	height := mineTransactions(t, chain, locked).Height
+
+	generateUntil(t, chain, height+delay-1)
+
+	// one block early, the input's relative lock time isn't met yet
+	rejectTransactions(t, chain, ErrSequenceLockNotMet, spendWithLock(chain, owner, locked, 0, delay))
+
+	generateUntil(t, chain, height+delay)
+
+	// a relative lock time met by the chain but shorter than the script's doesn't unlock the output
+	rejectTransactions(t, chain, ErrBadSignature, spendWithLock(chain, owner, locked, 0, delay-1))
+
+	mineTransactions(t, chain, spendWithLock(chain, owner, locked, 0, delay))
+}
@@ -10,15 +10,26 @@ import (
 	"encoding/hex"
 	"fmt"
 	"golang-blockchain/wallet"
+	"io"
 	"log"
 	"math/big"
 	"strings"
 )
 
 type Transaction struct {
-	ID      []byte              // hash of the transaction
-	Inputs  []TransactionInput  // inputs referecing previous transactions' outputs
-	Outputs []TransactionOutput // newly created outputs
+	ID       []byte              // hash of the transaction
+	Inputs   []TransactionInput  // inputs referecing previous transactions' outputs
+	Outputs  []TransactionOutput // newly created outputs
+	LockTime uint32              // the height, or unix time from LockTimeThreshold on, the transaction can't be mined before, see timelock.go
+}
+
+// gob numbers types in the order a process first encodes them, and those numbers end up in the encoding,
+// so transactions are encoded once up front for them to serialize, and hash, the same way in every process
+func init() {
+	err := gob.NewEncoder(io.Discard).Encode(Transaction{})
+	if err != nil {
+		log.Panic(err)
+	}
 }
 
 // serialize the transaction for later hashing
@@ -58,9 +69,32 @@ func (tx *Transaction) hash() []byte {
 	return hash[:]
 }
 
+// the transaction's ID is computed before it gets signed, so the inputs' unlocking scripts take no part in it
+// a coinbase's input isn't signed, and its data is what sets apart coinbases paying the same
+func (tx *Transaction) expectedID() []byte {
+	if tx.isCoinbase() {
+		return tx.hash()
+	}
+
+	txCopy := tx.trimmedCopy()
+
+	return txCopy.hash()
+}
+
 // create the blockchains' first transaction — the coinbase transaction
-// the coinbase includes a reward that's given to the first recepient, in this case, 100 tokens
-func CoinbaseTx(to, data string) *Transaction {
+// the coinbase includes a reward that's given to the block's miner, the value of which follows the subsidy schedule
+func CoinbaseTx(to, data string, value int) *Transaction {
+	return PayoutCoinbaseTx([]Payout{{to, value}}, data)
+}
+
+// an amount a coinbase pays to an address
+type Payout struct {
+	Address string
+	Value   int
+}
+
+// same as CoinbaseTx, but the reward is split into one output per payout, as a pool pays its miners
+func PayoutCoinbaseTx(payouts []Payout, data string) *Transaction {
 	if data == "" {
 		randData := make([]byte, 24)
 		_, err := rand.Read(randData)
@@ -68,25 +102,45 @@ func CoinbaseTx(to, data string) *Transaction {
 		data = fmt.Sprintf("%x", randData)
 	}
 
-	txInput := TransactionInput{[]byte{}, -1, nil, []byte(data)}
-	txOutput := NewTransactionOutput(20, to) // a reward of 20 tokens for the first miner
+	txInput := TransactionInput{[]byte{}, -1, Script(data), 0}
 
-	tx := Transaction{nil, []TransactionInput{txInput}, []TransactionOutput{*txOutput}}
+	var txOutputs []TransactionOutput
+	for _, payout := range payouts {
+		txOutputs = append(txOutputs, *NewTransactionOutput(payout.Value, payout.Address))
+	}
+
+	tx := Transaction{nil, []TransactionInput{txInput}, txOutputs, 0}
 	tx.ID = tx.hash()
 
 	return &tx
 }
 
-// create a new transaction
-func NewTransaction(w *wallet.Wallet, to string, amount int, UTXO *UTXOSet) *Transaction {
+// create a new transaction sending amount tokens to the given address
+// the fee is left unclaimed by the outputs, so whoever mines the transaction can collect it
+func NewTransaction(w *wallet.Wallet, to string, amount, fee int, UTXO *UTXOSet) *Transaction {
+	return NewScriptTransaction(w, LockingScript(to), amount, fee, UTXO)
+}
+
+// same as NewTransaction, but the tokens sent are locked with the given script
+func NewScriptTransaction(w *wallet.Wallet, to Script, amount, fee int, UTXO *UTXOSet) *Transaction {
+	return newTransaction(w, []TransactionOutput{{amount, to}}, fee, UTXO)
+}
+
+// create a new transaction paying the outputs from the wallet's tokens
+func newTransaction(w *wallet.Wallet, payments []TransactionOutput, fee int, UTXO *UTXOSet) *Transaction {
 	var inputs []TransactionInput
 	var outputs []TransactionOutput
 
+	amount := 0
+	for _, payment := range payments {
+		amount += payment.Value
+	}
+
 	publicKeyHash := wallet.PublicKeyHash(w.PublicKey)
 
-	acc, validOutputs := UTXO.FindSpendableOutputs(publicKeyHash, amount)
+	acc, validOutputs := UTXO.FindSpendableOutputs([]Script{P2PKHScript(publicKeyHash)}, amount+fee)
 
-	if acc < amount {
+	if acc < amount+fee || len(validOutputs) == 0 {
 		log.Panic("Error: not enough funds")
 	}
 
@@ -95,20 +149,20 @@ func NewTransaction(w *wallet.Wallet, to string, amount int, UTXO *UTXOSet) *Tra
 		Handle(err)
 
 		for _, out := range outputs {
-			input := TransactionInput{txID, out, nil, w.PublicKey}
+			input := TransactionInput{txID, out, nil, 0}
 			inputs = append(inputs, input)
 		}
 	}
 
 	from := fmt.Sprintf("%s", w.Address())
-	outputs = append(outputs, *NewTransactionOutput(amount, to))
+	outputs = append(outputs, payments...)
 
-	// if we have tokens leftover, we need to point them to ourselves
-	if acc > amount {
-		outputs = append(outputs, *NewTransactionOutput(acc-amount, from))
+	// if we have tokens leftover after paying the fee, we need to point them to ourselves
+	if acc > amount+fee {
+		outputs = append(outputs, *NewTransactionOutput(acc-amount-fee, from))
 	}
 
-	tx := Transaction{nil, inputs, outputs}
+	tx := Transaction{nil, inputs, outputs, 0}
 	tx.ID = tx.hash()
 	UTXO.Blockchain.SignTransaction(&tx, w.PrivateKey)
 
@@ -120,6 +174,7 @@ func (tx *Transaction) isCoinbase() bool {
 }
 
 // sign the transaction using the private key
+// every input is unlocked with the signature and the key's public key, as pay-to-public-key-hash outputs need
 func (tx *Transaction) sign(privateKey ecdsa.PrivateKey, previousTXs map[string]Transaction) {
 	// coinbase transactions don't need to be signed
 	if tx.isCoinbase() {
@@ -133,56 +188,62 @@ func (tx *Transaction) sign(privateKey ecdsa.PrivateKey, previousTXs map[string]
 		}
 	}
 
-	// create a copy of the transaction, and populate it with the previous transactions
-	// this is done because we need to modify the transaction in order to sign it
-	txCopy := tx.trimmedCopy()
+	publicKey := publicKeyBytes(privateKey)
 
-	for inId, in := range txCopy.Inputs {
+	for inId, in := range tx.Inputs {
 		previousTX := previousTXs[hex.EncodeToString(in.ID)]
+		signature := tx.signInput(inId, previousTX.Outputs[in.Output].ScriptPubKey, privateKey)
 
-		// clear signature and set public key to the previous output's public key hash
-		// this recreates the state of the transaction at signing time
-		txCopy.Inputs[inId].Signature = nil
-		txCopy.Inputs[inId].PublicKey = previousTX.Outputs[in.Output].PublicKeyHash
+		// store the signature in the actual transaction
+		tx.Inputs[inId].ScriptSig = P2PKHScriptSig(signature, publicKey)
+	}
+}
 
-		// calculate the hash of this state
-		txCopy.ID = txCopy.hash()
+// the public key of the private key, as wallets encode it
+func publicKeyBytes(privateKey ecdsa.PrivateKey) []byte {
+	return append(privateKey.PublicKey.X.FillBytes(make([]byte, 32)), privateKey.PublicKey.Y.FillBytes(make([]byte, 32))...)
+}
 
-		// clear the public key as it's no longer needed
-		txCopy.Inputs[inId].PublicKey = nil
+// sign the input, with subscript being the script of the output it spends
+func (tx *Transaction) signInput(input int, subscript Script, privateKey ecdsa.PrivateKey) []byte {
+	r, s, err := ecdsa.Sign(rand.Reader, &privateKey, tx.sigHash(input, subscript))
+	Handle(err)
 
-		// sign the hash using the private key
-		r, s, err := ecdsa.Sign(rand.Reader, &privateKey, txCopy.ID)
-		Handle(err)
+	// combine the signature components (r,s) into a single byte slice
+	// both are padded to 32 bytes so the signature can be split back in half
+	return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+}
 
-		// combine the signature components (r,s) into a single byte slice
-		signature := append(r.Bytes(), s.Bytes()...)
+// the hash an input's signature signs: the transaction without any unlocking script,
+// but for the signed input's, which is replaced by subscript, the script of the output it spends
+// this recreates the state of the transaction at signing time
+func (tx *Transaction) sigHash(input int, subscript Script) []byte {
+	txCopy := tx.trimmedCopy()
+	txCopy.Inputs[input].ScriptSig = subscript
 
-		// store the signature in the actual transaction
-		tx.Inputs[inId].Signature = signature
-	}
+	return txCopy.hash()
 }
 
-// create a trimmed copy of the transaction by removing the signature and public key
+// create a trimmed copy of the transaction by removing the inputs' unlocking scripts
 func (tx *Transaction) trimmedCopy() Transaction {
 	var inputs []TransactionInput
 	var outputs []TransactionOutput
 
 	for _, in := range tx.Inputs {
 		// trimming out the signature and the public key
-		inputs = append(inputs, TransactionInput{in.ID, in.Output, nil, nil})
+		inputs = append(inputs, TransactionInput{in.ID, in.Output, nil, in.Sequence})
 	}
 
 	for _, out := range tx.Outputs {
-		outputs = append(outputs, TransactionOutput{out.Value, out.PublicKeyHash})
+		outputs = append(outputs, TransactionOutput{out.Value, out.ScriptPubKey})
 	}
 
-	txCopy := Transaction{tx.ID, inputs, outputs}
+	txCopy := Transaction{tx.ID, inputs, outputs, tx.LockTime}
 
 	return txCopy
 }
 
-// verify a transaction using the public key
+// verify the transaction by running every input's unlocking script against the script of the output it spends
 func (tx *Transaction) Verify(previousTXs map[string]Transaction) bool {
 	// coinbase transactions are always valid
 	if tx.isCoinbase() {
@@ -196,36 +257,9 @@ func (tx *Transaction) Verify(previousTXs map[string]Transaction) bool {
 		}
 	}
 
-	// create a copy of the transaction, and populate it with the previous transactions
-	// this is done because we need to modify the transaction in order to verify it
-	txCopy := tx.trimmedCopy()
-	curve := elliptic.P256()
-
-	for inId, in := range txCopy.Inputs {
-		// recreate the same state as when the transaction was signed
+	for inId, in := range tx.Inputs {
 		previousTX := previousTXs[hex.EncodeToString(in.ID)]
-		txCopy.Inputs[inId].Signature = nil
-		txCopy.Inputs[inId].PublicKey = previousTX.Outputs[in.Output].PublicKeyHash
-		txCopy.ID = txCopy.hash()
-		txCopy.Inputs[inId].PublicKey = nil
-
-		// deconstruct the signature into its components
-		r := big.Int{}
-		s := big.Int{}
-		sigLen := len(in.Signature)
-		r.SetBytes(in.Signature[:(sigLen / 2)])
-		s.SetBytes(in.Signature[(sigLen / 2):])
-
-		// deconstruct the public key into its coordinates
-		x := big.Int{}
-		y := big.Int{}
-		keyLen := len(in.PublicKey)
-		x.SetBytes(in.PublicKey[:(keyLen / 2)])
-		y.SetBytes(in.PublicKey[(keyLen / 2):])
-
-		// verify the signature
-		rawPublicKey := ecdsa.PublicKey{Curve: curve, X: &x, Y: &y}
-		if ecdsa.Verify(&rawPublicKey, txCopy.ID, &r, &s) == false {
+		if tx.verifyInput(inId, previousTX.Outputs[in.Output]) != nil {
 			return false
 		}
 	}
@@ -233,6 +267,33 @@ func (tx *Transaction) Verify(previousTXs map[string]Transaction) bool {
 	return true
 }
 
+// run the input's unlocking script against the script of the output it spends
+func (tx *Transaction) verifyInput(input int, spent TransactionOutput) error {
+	return VerifyScript(tx.Inputs[input].ScriptSig, spent.ScriptPubKey, &txSignatureChecker{tx, input})
+}
+
+// checks signatures against one of a transaction's inputs
+type txSignatureChecker struct {
+	tx    *Transaction
+	input int
+}
+
+func (checker *txSignatureChecker) CheckSig(signature, publicKey []byte, subscript Script) bool {
+	// signatures and public keys are both two 32 byte numbers
+	if len(signature) != 64 || len(publicKey) != 64 {
+		return false
+	}
+
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+
+	x := new(big.Int).SetBytes(publicKey[:32])
+	y := new(big.Int).SetBytes(publicKey[32:])
+	rawPublicKey := ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+
+	return ecdsa.Verify(&rawPublicKey, checker.tx.sigHash(checker.input, subscript), r, s)
+}
+
 // stringify the transaction
 func (tx Transaction) String() string {
 	var lines []string
@@ -242,14 +303,24 @@ func (tx Transaction) String() string {
 		lines = append(lines, fmt.Sprintf("     Input %d:", i))
 		lines = append(lines, fmt.Sprintf("       TXID:     %x", input.ID))
 		lines = append(lines, fmt.Sprintf("       Out:       %d", input.Output))
-		lines = append(lines, fmt.Sprintf("       Signature: %x", input.Signature))
-		lines = append(lines, fmt.Sprintf("       PubKey:    %x", input.PublicKey))
+		if tx.isCoinbase() {
+			lines = append(lines, fmt.Sprintf("       Data:      %x", []byte(input.ScriptSig)))
+		} else {
+			lines = append(lines, fmt.Sprintf("       ScriptSig: %s", input.ScriptSig))
+		}
+		if input.Sequence != 0 {
+			lines = append(lines, fmt.Sprintf("       Sequence:  %08x", input.Sequence))
+		}
 	}
 
 	for i, output := range tx.Outputs {
 		lines = append(lines, fmt.Sprintf("     Output %d:", i))
 		lines = append(lines, fmt.Sprintf("       Value:  %d", output.Value))
-		lines = append(lines, fmt.Sprintf("       Script: %x", output.PublicKeyHash))
+		lines = append(lines, fmt.Sprintf("       Script: %s", output.ScriptPubKey))
+	}
+
+	if tx.LockTime != 0 {
+		lines = append(lines, fmt.Sprintf("     Lock time: %d", tx.LockTime))
 	}
 
 	return strings.Join(lines, "\n")
@@ -3,45 +3,71 @@ package blockchain
 import (
 	"bytes"
 	"encoding/gob"
+	"golang-blockchain/params"
 	"golang-blockchain/wallet"
 )
 
 type TransactionInput struct {
 	ID        []byte // the ID of the transaction whose outputs will serve as inputs
 	Output    int    // the index of the list of outputs of that transaction
-	Signature []byte // the hashed key of the owner of the referenced output
-	PublicKey []byte // the public key of the owner of the referenced output
+	ScriptSig Script // the data meeting the referenced output's script, e.g. the owner's signature and public key
+	Sequence  uint32 // the input's relative lock time, see timelock.go
 }
 
 type TransactionOutput struct {
-	Value         int    // token amount
-	PublicKeyHash []byte // the hashed recepient's address
+	Value        int    // token amount
+	ScriptPubKey Script // the conditions for spending the output, e.g. being the owner of the recepient's address
 }
 
+// the outputs of a transaction that are still unspent, keyed by their index in the transaction
 type TransactionOutputs struct {
-	Outputs []TransactionOutput
+	Outputs  map[int]TransactionOutput
+	Height   int  // height of the block containing the transaction
+	Coinbase bool // whether the transaction is a coinbase, whose outputs need to mature before being spent
 }
 
 func NewTransactionOutput(value int, address string) *TransactionOutput {
 	txOut := &TransactionOutput{value, nil}
 
-	// lock the output to the address by parameterizing the public key hash
+	// lock the output to the address with a pay-to-public-key-hash or pay-to-script-hash script
 	txOut.lock([]byte(address))
 
 	return txOut
 }
 
 func (out *TransactionOutput) lock(address []byte) {
-	publicKeyHash := wallet.Base58Decode(address)
+	out.ScriptPubKey = LockingScript(string(address))
+}
+
+// the standard script locking outputs to the address, depending on whether it's the address of a key or a script
+func LockingScript(address string) Script {
+	fullHash := wallet.Base58Decode([]byte(address))
 
 	// remove version and checksum
-	publicKeyHash = publicKeyHash[1 : len(publicKeyHash)-4]
-	out.PublicKeyHash = publicKeyHash
+	hash := fullHash[1 : len(fullHash)-4]
+	if fullHash[0] == params.Active.ScriptAddressVersion {
+		return P2SHScript(hash)
+	}
+
+	return P2PKHScript(hash)
+}
+
+// check if the output is locked with one of the scripts
+func (out *TransactionOutput) isLockedWith(scripts []Script) bool {
+	for _, script := range scripts {
+		if bytes.Equal(out.ScriptPubKey, script) {
+			return true
+		}
+	}
+
+	return false
 }
 
-// check if the output is locked with the given public key hash
-func (out *TransactionOutput) isLockedWithKey(publicKeyHash []byte) bool {
-	return bytes.Compare(out.PublicKeyHash, publicKeyHash) == 0
+// check if the outputs can be spent by a transaction included at the given height
+// coinbases need maturity blocks built on top of them first, which keeps miners from spending
+// rewards that could still vanish in a reorganization
+func (outs TransactionOutputs) isMature(spendHeight, maturity int) bool {
+	return !outs.Coinbase || spendHeight-outs.Height >= maturity
 }
 
 func (outs TransactionOutputs) Serialize() []byte {
@@ -18,11 +18,13 @@ type UTXOSet struct {
 	Blockchain *BlockChain // refenrece a Blockchain for its inclusion of a database pointer
 }
 
-// retrieve amount of tokens aswell as the transactions' IDs whose outputs concern the address' recipient
-func (u *UTXOSet) FindSpendableOutputs(publicKeyHash []byte, amountToSend int) (int, map[string][]int) {
+// retrieve amount of tokens aswell as the transactions' IDs whose outputs are locked with one of the scripts
+// coinbase outputs that haven't matured yet are left out
+func (u *UTXOSet) FindSpendableOutputs(scripts []Script, amountToSend int) (int, map[string][]int) {
 	unspentOutputs := make(map[string][]int)
 	accumulated := 0
 	db := u.Blockchain.Database
+	spendHeight := u.Blockchain.GetBestHeight() + 1
 
 	err := db.View(func(txn *badger.Txn) error {
 		opts := badger.DefaultIteratorOptions
@@ -44,9 +46,13 @@ func (u *UTXOSet) FindSpendableOutputs(publicKeyHash []byte, amountToSend int) (
 			k = bytes.TrimPrefix(k, UTXOPrefix)
 			txID := hex.EncodeToString(k)
 			outs := DeserializeOutputs(val)
+			if !outs.isMature(spendHeight, u.Blockchain.Params.CoinbaseMaturity) {
+				continue
+			}
 
 			for outIdx, out := range outs.Outputs {
-				if out.isLockedWithKey(publicKeyHash) && accumulated < amountToSend {
+				// a transaction needs an input even when it sends nothing and pays no fee
+				if out.isLockedWith(scripts) && (accumulated < amountToSend || len(unspentOutputs) == 0) {
 					accumulated += out.Value
 					unspentOutputs[txID] = append(unspentOutputs[txID], outIdx)
 				}
@@ -62,7 +68,7 @@ func (u *UTXOSet) FindSpendableOutputs(publicKeyHash []byte, amountToSend int) (
 }
 
 // locate the unspent transaction outputs (UTXOs)
-func (u *UTXOSet) FindUTXO(publicKeyHash []byte) []TransactionOutput {
+func (u *UTXOSet) FindUTXO(scripts []Script) []TransactionOutput {
 	var UTXOs []TransactionOutput
 
 	db := u.Blockchain.Database
@@ -85,7 +91,7 @@ func (u *UTXOSet) FindUTXO(publicKeyHash []byte) []TransactionOutput {
 			Handle(err)
 			outs := DeserializeOutputs(val)
 			for _, out := range outs.Outputs {
-				if out.isLockedWithKey(publicKeyHash) {
+				if out.isLockedWith(scripts) {
 					UTXOs = append(UTXOs, out)
 				}
 			}
@@ -98,6 +104,49 @@ func (u *UTXOSet) FindUTXO(publicKeyHash []byte) []TransactionOutput {
 	return UTXOs
 }
 
+// sum up the tokens locked with one of the scripts, telling apart the ones that can be spent
+// right away from coinbase rewards that still need to mature
+func (u *UTXOSet) FindBalance(scripts []Script) (int, int) {
+	spendable, immature := 0, 0
+	db := u.Blockchain.Database
+	spendHeight := u.Blockchain.GetBestHeight() + 1
+
+	err := db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(UTXOPrefix); it.ValidForPrefix(UTXOPrefix); it.Next() {
+			var val []byte
+			err := it.Item().Value(func(v []byte) error {
+				// this func with val would only be called if item.Value() encounters no error.
+				val = slices.Clone(v)
+				return nil
+			})
+			Handle(err)
+
+			outs := DeserializeOutputs(val)
+			for _, out := range outs.Outputs {
+				if !out.isLockedWith(scripts) {
+					continue
+				}
+
+				if outs.isMature(spendHeight, u.Blockchain.Params.CoinbaseMaturity) {
+					spendable += out.Value
+				} else {
+					immature += out.Value
+				}
+			}
+		}
+
+		return nil
+	})
+	Handle(err)
+
+	return spendable, immature
+}
+
 func (u *UTXOSet) CountTransactions() int {
 	db := u.Blockchain.Database
 	counter := 0
@@ -131,9 +180,8 @@ func (u *UTXOSet) Reindex() {
 			if err != nil {
 				return err
 			}
-			key = append(UTXOPrefix, key...)
 
-			err = txn.Set(key, outs.Serialize())
+			err = txn.Set(utxoKey(key), outs.Serialize())
 			Handle(err)
 		}
 		return nil
@@ -141,59 +189,33 @@ func (u *UTXOSet) Reindex() {
 	Handle(err)
 }
 
-func (u *UTXOSet) Update(block *Block) {
-	db := u.Blockchain.Database
-
-	err := db.Update(func(txn *badger.Txn) error {
-		for _, tx := range block.Transactions {
-			if !tx.isCoinbase() {
-				for _, in := range tx.Inputs {
-					updatedOutputs := TransactionOutputs{}
-					inID := append(UTXOPrefix, in.ID...)
-					item, err := txn.Get(inID)
-					Handle(err)
-					var val []byte
-					err = item.Value(func(v []byte) error {
-						// this func with val would only be called if item.Value() encounters no error.
-						val = slices.Clone(v)
-						return nil
-					})
-					Handle(err)
-
-					outs := DeserializeOutputs(val)
-
-					for outIdx, out := range outs.Outputs {
-						if outIdx != in.Output {
-							updatedOutputs.Outputs = append(updatedOutputs.Outputs, out)
-						}
-					}
-
-					if len(updatedOutputs.Outputs) == 0 {
-						if err := txn.Delete(inID); err != nil {
-							log.Panic(err)
-						}
-					} else {
-						if err := txn.Set(inID, updatedOutputs.Serialize()); err != nil {
-							log.Panic(err)
-						}
-					}
-				}
-			}
-			newOutputs := TransactionOutputs{}
-			for _, out := range tx.Outputs {
-				newOutputs.Outputs = append(newOutputs.Outputs, out)
-			}
+func utxoKey(txID []byte) []byte {
+	return append(slices.Clone(UTXOPrefix), txID...)
+}
 
-			txID := append(UTXOPrefix, tx.ID...)
-			if err := txn.Set(txID, newOutputs.Serialize()); err != nil {
-				log.Panic(err)
-			}
-		}
+// fetch the unspent outputs left of the given transaction
+func getOutputs(txn *badger.Txn, txID []byte) (TransactionOutputs, error) {
+	item, err := txn.Get(utxoKey(txID))
+	if err != nil {
+		return TransactionOutputs{}, err
+	}
 
+	var outs TransactionOutputs
+	err = item.Value(func(v []byte) error {
+		outs = DeserializeOutputs(slices.Clone(v))
 		return nil
 	})
 
-	Handle(err)
+	return outs, err
+}
+
+// store the transaction's unspent outputs, dropping its entry once all of them have been spent
+func putOutputs(txn *badger.Txn, txID []byte, outs TransactionOutputs) error {
+	if len(outs.Outputs) == 0 {
+		return txn.Delete(utxoKey(txID))
+	}
+
+	return txn.Set(utxoKey(txID), outs.Serialize())
 }
 
 func (u *UTXOSet) deleteByPrefix(prefix []byte) {
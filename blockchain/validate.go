@@ -0,0 +1,426 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"github.com/dgraph-io/badger"
+)
+
+// identifies which consensus rule a block or transaction broke
+type ErrorCode int
+
+const (
+	ErrMissingParent ErrorCode = iota
+	ErrBadHeight
+	ErrBadHash
+	ErrBadTarget
+	ErrBadProofOfWork
+	ErrNoTransactions
+	ErrBadMerkleRoot
+	ErrBadTransactionID
+	ErrDuplicateTransaction
+	ErrFirstTxNotCoinbase
+	ErrMultipleCoinbases
+	ErrBadCoinbaseValue
+	ErrBadOutputValue
+	ErrMissingInput
+	ErrDoubleSpend
+	ErrBadSignature
+	ErrSpendTooHigh
+	ErrImmatureSpend
+	ErrTimeTooOld
+	ErrTimeTooNew
+	ErrUnauthorizedSigner
+	ErrBadBlockSignature
+	ErrBlockTooBig
+	ErrTxTooBig
+	ErrTooManyInputs
+	ErrCheckpointMismatch
+	ErrForkTooOld
+	ErrNonFinalTransaction
+	ErrSequenceLockNotMet
+	ErrBadDataOutput
+)
+
+var errorCodeStrings = map[ErrorCode]string{
+	ErrMissingParent:        "ErrMissingParent",
+	ErrBadHeight:            "ErrBadHeight",
+	ErrBadHash:              "ErrBadHash",
+	ErrBadTarget:            "ErrBadTarget",
+	ErrBadProofOfWork:       "ErrBadProofOfWork",
+	ErrNoTransactions:       "ErrNoTransactions",
+	ErrBadMerkleRoot:        "ErrBadMerkleRoot",
+	ErrBadTransactionID:     "ErrBadTransactionID",
+	ErrDuplicateTransaction: "ErrDuplicateTransaction",
+	ErrFirstTxNotCoinbase:   "ErrFirstTxNotCoinbase",
+	ErrMultipleCoinbases:    "ErrMultipleCoinbases",
+	ErrBadCoinbaseValue:     "ErrBadCoinbaseValue",
+	ErrBadOutputValue:       "ErrBadOutputValue",
+	ErrMissingInput:         "ErrMissingInput",
+	ErrDoubleSpend:          "ErrDoubleSpend",
+	ErrBadSignature:         "ErrBadSignature",
+	ErrSpendTooHigh:         "ErrSpendTooHigh",
+	ErrImmatureSpend:        "ErrImmatureSpend",
+	ErrTimeTooOld:           "ErrTimeTooOld",
+	ErrTimeTooNew:           "ErrTimeTooNew",
+	ErrUnauthorizedSigner:   "ErrUnauthorizedSigner",
+	ErrBadBlockSignature:    "ErrBadBlockSignature",
+	ErrBlockTooBig:          "ErrBlockTooBig",
+	ErrTxTooBig:             "ErrTxTooBig",
+	ErrTooManyInputs:        "ErrTooManyInputs",
+	ErrCheckpointMismatch:   "ErrCheckpointMismatch",
+	ErrForkTooOld:           "ErrForkTooOld",
+	ErrNonFinalTransaction:  "ErrNonFinalTransaction",
+	ErrSequenceLockNotMet:   "ErrSequenceLockNotMet",
+	ErrBadDataOutput:        "ErrBadDataOutput",
+}
+
+func (code ErrorCode) String() string {
+	if s, ok := errorCodeStrings[code]; ok {
+		return s
+	}
+
+	return fmt.Sprintf("Unknown ErrorCode (%d)", int(code))
+}
+
+// RuleError is returned when a block or transaction breaks a consensus rule
+// use errors.As to find out which rule, through ErrorCode, was broken
+type RuleError struct {
+	ErrorCode   ErrorCode
+	Description string
+}
+
+func (e RuleError) Error() string {
+	return fmt.Sprintf("%s: %s", e.ErrorCode, e.Description)
+}
+
+func ruleError(code ErrorCode, format string, args ...any) RuleError {
+	return RuleError{code, fmt.Sprintf(format, args...)}
+}
+
+// check every consensus rule the block must follow to be added to the chain:
+// its header must extend a known block and be sealed as the chain's consensus engine requires,
+// and its transactions must be well formed and spend existing outputs, once, with valid signatures
+// returns a RuleError describing the first rule that failed
+// AddBlock checks the same rules as it connects the block, so it doesn't go through here
+func (chain *BlockChain) ValidateBlock(block *Block) error {
+	if err := chain.checkBlock(block); err != nil {
+		return err
+	}
+
+	// replay the block on top of the UTXO set as it was at the block's parent, without committing anything
+	txn := chain.Database.NewTransaction(true)
+	defer txn.Discard()
+
+	tip, err := getLastHash(txn)
+	Handle(err)
+
+	return chain.connectOnBranch(txn, tip, block)
+}
+
+// the checks that don't need the UTXO set
+func (chain *BlockChain) checkBlock(block *Block) error {
+	if err := chain.checkBlockSanity(block); err != nil {
+		return err
+	}
+
+	if err := chain.checkCheckpoints(block); err != nil {
+		return err
+	}
+
+	return chain.checkBlockHeader(block)
+}
+
+// the checks that don't depend on the rest of the chain
+func (chain *BlockChain) checkBlockSanity(block *Block) error {
+	if len(block.Transactions) == 0 {
+		return ruleError(ErrNoTransactions, "block %x has no transactions", block.Hash)
+	}
+
+	if size := len(block.Serialize()); size > chain.Params.MaxBlockSize {
+		return ruleError(ErrBlockTooBig, "block %x is %d bytes, more than the limit of %d", block.Hash, size, chain.Params.MaxBlockSize)
+	}
+
+	if !bytes.Equal(block.MerkleRoot, block.HashTransactions()) {
+		return ruleError(ErrBadMerkleRoot, "block %x's merkle root doesn't match its transactions", block.Hash)
+	}
+
+	if !bytes.Equal(block.Hash, block.BlockHeader.Hash()) {
+		return ruleError(ErrBadHash, "block %x's hash doesn't match its header", block.Hash)
+	}
+
+	if !block.Transactions[0].isCoinbase() {
+		return ruleError(ErrFirstTxNotCoinbase, "block %x's first transaction isn't a coinbase", block.Hash)
+	}
+
+	seen := make(map[string]bool)
+	for i, tx := range block.Transactions {
+		if i > 0 && tx.isCoinbase() {
+			return ruleError(ErrMultipleCoinbases, "block %x has more than one coinbase", block.Hash)
+		}
+
+		if !bytes.Equal(tx.ID, tx.expectedID()) {
+			return ruleError(ErrBadTransactionID, "transaction %x's ID doesn't match its contents", tx.ID)
+		}
+
+		if err := chain.checkTransactionSize(tx); err != nil {
+			return err
+		}
+
+		txID := hex.EncodeToString(tx.ID)
+		if seen[txID] {
+			return ruleError(ErrDuplicateTransaction, "block %x contains transaction %x twice", block.Hash, tx.ID)
+		}
+		seen[txID] = true
+
+		if err := chain.checkOutputValues(tx); err != nil {
+			return err
+		}
+
+		if err := chain.checkDataOutputs(tx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// blocks at a checkpoint's height must be the checkpointed block, and once the chain
+// is past the last checkpoint, no branch may fork off below it
+func (chain *BlockChain) checkCheckpoints(block *Block) error {
+	if hash, ok := chain.Params.CheckpointAt(block.Height); ok && hash != hex.EncodeToString(block.Hash) {
+		return ruleError(ErrCheckpointMismatch, "block %x at height %d doesn't match checkpoint %s", block.Hash, block.Height, hash)
+	}
+
+	// the block isn't known yet, so at a height below the last checkpoint it can only be on a side branch
+	last := chain.Params.LastCheckpoint()
+	if last != nil && block.Height < last.Height && chain.GetBestHeight() >= last.Height {
+		return ruleError(ErrForkTooOld, "block %x at height %d forks off below the checkpoint at height %d", block.Hash, block.Height, last.Height)
+	}
+
+	return nil
+}
+
+// the hashes of blocks known to lead up to the last checkpoint, gathered by following the parent hashes
+// back from the checkpointed block as it and its ancestors arrive, e.g. while they're held as orphans
+type checkpointAncestry struct {
+	mutex  sync.Mutex
+	hashes map[string]bool
+}
+
+// note the block's parent as leading up to the last checkpoint if the block itself does
+// the block's hash has to be the hash of its header, which commits to the parent, for the parent to be known
+func (chain *BlockChain) noteCheckpointAncestry(block *Block) {
+	if !bytes.Equal(block.Hash, block.BlockHeader.Hash()) || !chain.isCheckpointAncestor(block.Hash) {
+		return
+	}
+
+	ancestry := &chain.checkpointed
+	ancestry.mutex.Lock()
+	defer ancestry.mutex.Unlock()
+
+	if ancestry.hashes == nil {
+		ancestry.hashes = make(map[string]bool)
+	}
+	ancestry.hashes[hex.EncodeToString(block.PrevHash)] = true
+}
+
+// check if the block is the last checkpoint's block, or one of the blocks known to lead up to it
+func (chain *BlockChain) isCheckpointAncestor(hash []byte) bool {
+	last := chain.Params.LastCheckpoint()
+	if last == nil {
+		return false
+	}
+
+	if hex.EncodeToString(hash) == last.Hash {
+		return true
+	}
+
+	ancestry := &chain.checkpointed
+	ancestry.mutex.Lock()
+	defer ancestry.mutex.Unlock()
+
+	return ancestry.hashes[hex.EncodeToString(hash)]
+}
+
+// the checks that tie the header to its parent
+func (chain *BlockChain) checkBlockHeader(block *Block) error {
+	parent, err := chain.GetBlock(block.PrevHash)
+	if err != nil {
+		return ruleError(ErrMissingParent, "parent %x of block %x is unknown", block.PrevHash, block.Hash)
+	}
+
+	if block.Height != parent.Height+1 {
+		return ruleError(ErrBadHeight, "block %x has height %d, expected %d", block.Hash, block.Height, parent.Height+1)
+	}
+
+	medianTime, err := chain.CalcPastMedianTime(block.PrevHash)
+	if err != nil {
+		return err
+	}
+
+	if block.Timestamp <= medianTime {
+		return ruleError(ErrTimeTooOld, "block %x's timestamp %d is not after the median time past %d", block.Hash, block.Timestamp, medianTime)
+	}
+
+	if maxTime := chain.now().Add(MaxFutureBlockTime).Unix(); block.Timestamp > maxTime {
+		return ruleError(ErrTimeTooNew, "block %x's timestamp %d is too far in the future, the latest allowed is %d", block.Hash, block.Timestamp, maxTime)
+	}
+
+	return chain.Engine.VerifyHeader(chain, &block.BlockHeader)
+}
+
+// check a transaction that is not in a block yet against the current UTXO set
+// returns the fee the transaction pays to whoever mines it
+func (chain *BlockChain) ValidateTransaction(tx *Transaction) (int, error) {
+	var fee int
+
+	if tx.isCoinbase() {
+		return 0, ruleError(ErrMultipleCoinbases, "transaction %x is a coinbase", tx.ID)
+	}
+
+	if !bytes.Equal(tx.ID, tx.expectedID()) {
+		return 0, ruleError(ErrBadTransactionID, "transaction %x's ID doesn't match its contents", tx.ID)
+	}
+
+	if err := chain.checkTransactionSize(tx); err != nil {
+		return 0, err
+	}
+
+	if err := chain.checkOutputValues(tx); err != nil {
+		return 0, err
+	}
+
+	if err := chain.checkDataOutputs(tx); err != nil {
+		return 0, err
+	}
+
+	err := chain.Database.View(func(txn *badger.Txn) error {
+		tip, err := getLastHash(txn)
+		Handle(err)
+		tipBlock, err := getBlock(txn, tip)
+		Handle(err)
+
+		// the transaction would be included in the next block at the earliest
+		fee, err = chain.checkTransactionInputs(txn, tx, tipBlock.Height+1, tip, false)
+		return err
+	})
+
+	return fee, err
+}
+
+// check none of the transaction's outputs is negative or worth more than the maximum supply
+func (chain *BlockChain) checkOutputValues(tx *Transaction) error {
+	for _, out := range tx.Outputs {
+		if out.Value < 0 {
+			return ruleError(ErrBadOutputValue, "transaction %x has a negative output", tx.ID)
+		}
+		if out.Value > chain.Params.MaxSupply {
+			return ruleError(ErrBadOutputValue, "transaction %x has an output of %d tokens, more than the maximum supply of %d", tx.ID, out.Value, chain.Params.MaxSupply)
+		}
+	}
+
+	return nil
+}
+
+// check the transaction stays within the chain's size and input count limits
+func (chain *BlockChain) checkTransactionSize(tx *Transaction) error {
+	if len(tx.Inputs) > chain.Params.MaxTxInputs {
+		return ruleError(ErrTooManyInputs, "transaction %x has %d inputs, more than the limit of %d", tx.ID, len(tx.Inputs), chain.Params.MaxTxInputs)
+	}
+
+	if size := len(tx.Serialize()); size > chain.Params.MaxTxSize {
+		return ruleError(ErrTxTooBig, "transaction %x is %d bytes, more than the limit of %d", tx.ID, size, chain.Params.MaxTxSize)
+	}
+
+	return nil
+}
+
+// check the transaction's unspendable outputs are standard data outputs carrying no tokens, and no more data than the chain allows
+func (chain *BlockChain) checkDataOutputs(tx *Transaction) error {
+	for outIdx, out := range tx.Outputs {
+		if !out.ScriptPubKey.IsUnspendable() {
+			continue
+		}
+
+		data, ok := out.ScriptPubKey.Data()
+		if !ok {
+			return ruleError(ErrBadDataOutput, "transaction %x's output %d is unspendable but isn't a data output", tx.ID, outIdx)
+		}
+
+		if len(data) > chain.Params.MaxDataCarrierSize {
+			return ruleError(ErrBadDataOutput, "transaction %x's output %d carries %d bytes, more than the limit of %d", tx.ID, outIdx, len(data), chain.Params.MaxDataCarrierSize)
+		}
+
+		// nothing can spend the output, so its tokens would be lost
+		if out.Value != 0 {
+			return ruleError(ErrBadDataOutput, "transaction %x's data output %d holds %d tokens", tx.ID, outIdx, out.Value)
+		}
+	}
+
+	return nil
+}
+
+// check that every output the transaction spends exists in the UTXO set, that the transaction
+// is allowed to spend it, and that it doesn't create more tokens than it spends
+// the transaction's lock times must also allow it into a block at the given height, on top of prevHash
+// signatures aren't verified if trusted, for blocks known to lead up to a checkpoint
+// returns the transaction's fee: the tokens spent by its inputs that none of its outputs claim
+func (chain *BlockChain) checkTransactionInputs(txn *badger.Txn, tx *Transaction, height int, prevHash []byte, trusted bool) (int, error) {
+	inputValue := 0
+
+	// without inputs, anyone could make the transaction again, and nothing would tell the copies apart
+	if len(tx.Inputs) == 0 {
+		return 0, ruleError(ErrMissingInput, "transaction %x has no inputs", tx.ID)
+	}
+
+	if err := chain.checkLockTime(tx, height, prevHash); err != nil {
+		return 0, err
+	}
+
+	for inId, in := range tx.Inputs {
+		outs, err := getOutputs(txn, in.ID)
+		out, ok := outs.Outputs[in.Output]
+		if err != nil || !ok {
+			return 0, ruleError(ErrMissingInput, "transaction %x spends missing or already spent output %x:%d", tx.ID, in.ID, in.Output)
+		}
+
+		if !outs.isMature(height, chain.Params.CoinbaseMaturity) {
+			return 0, ruleError(ErrImmatureSpend, "transaction %x spends coinbase output %x:%d from height %d before it matured", tx.ID, in.ID, in.Output, outs.Height)
+		}
+
+		if err := chain.checkSequenceLock(txn, tx, inId, outs.Height, height, prevHash); err != nil {
+			return 0, err
+		}
+
+		if !trusted {
+			if err := tx.verifyInput(inId, out); err != nil {
+				return 0, ruleError(ErrBadSignature, "transaction %x can't unlock output %x:%d: %s", tx.ID, in.ID, in.Output, err)
+			}
+		}
+
+		// outputs were bounded by the maximum supply when created, so keeping the total within it keeps it from overflowing
+		inputValue += out.Value
+		if inputValue > chain.Params.MaxSupply {
+			return 0, ruleError(ErrBadOutputValue, "transaction %x spends more than the maximum supply of %d tokens", tx.ID, chain.Params.MaxSupply)
+		}
+	}
+
+	// every output was checked to be within the maximum supply on its own already
+	outputValue := 0
+	for _, out := range tx.Outputs {
+		outputValue += out.Value
+		if outputValue > chain.Params.MaxSupply {
+			return 0, ruleError(ErrBadOutputValue, "transaction %x's outputs add up to more than the maximum supply of %d tokens", tx.ID, chain.Params.MaxSupply)
+		}
+	}
+
+	if outputValue > inputValue {
+		return 0, ruleError(ErrSpendTooHigh, "transaction %x spends %d tokens but only has %d", tx.ID, outputValue, inputValue)
+	}
+
+	return inputValue - outputValue, nil
+}
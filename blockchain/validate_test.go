@@ -0,0 +1,248 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"golang-blockchain/params"
+	"golang-blockchain/wallet"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestValidateBlockRuleErrors(t *testing.T) {
+	chain, w := newFundedTestChain(t)
+	tip := tipBlock(t, chain)
+	height := tip.Height + 1
+
+	medianTime, err := chain.CalcPastMedianTime(tip.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// each case gets a block valid but for the rule it breaks
+	coinbase := func() *Transaction {
+		return newCoinbase(chain, height)
+	}
+	spend := func() *Transaction {
+		return newSpend(t, chain, w)
+	}
+	block := func(txs ...*Transaction) *Block {
+		return buildBlock(t, chain, tip, txs...)
+	}
+	changed := func(change func(block *Block), txs ...*Transaction) *Block {
+		b := block(txs...)
+		change(b)
+		reseal(t, chain, b)
+		return b
+	}
+	resigned := func(change func(tx *Transaction)) *Transaction {
+		tx := spend()
+		change(tx)
+		resign(chain, w, tx)
+		return tx
+	}
+
+	tests := []struct {
+		name  string
+		block *Block
+		err   ErrorCode
+	}{
+		{"unknown parent", buildBlock(t, chain, buildBranch(t, chain, tip, 1)[0], newCoinbase(chain, height+1)), ErrMissingParent},
+		{"wrong height", changed(func(b *Block) { b.Height++ }, coinbase()), ErrBadHeight},
+		{"proof-of-work block with a signer", changed(func(b *Block) { b.Signer = w.PublicKey }, coinbase()), ErrBadBlockSignature},
+		{"proof-of-work block with a signature", changed(func(b *Block) { b.Signature = make([]byte, 64) }, coinbase()), ErrBadBlockSignature},
+		{"hash not matching the header", func() *Block {
+			b := block(coinbase())
+			b.Hash = slices.Clone(b.Hash)
+			b.Hash[0] ^= 0xff
+			return b
+		}(), ErrBadHash},
+		{"no transactions", func() *Block {
+			b := block(coinbase())
+			b.Transactions = nil
+			return b
+		}(), ErrNoTransactions},
+		{"bad merkle root", func() *Block {
+			b := block(coinbase())
+			b.Transactions = append(b.Transactions, spend())
+			return b
+		}(), ErrBadMerkleRoot},
+		{"transaction ID not matching its contents", func() *Block {
+			tx := spend()
+			tx.Outputs[0].Value++
+			return block(coinbase(), tx)
+		}(), ErrBadTransactionID},
+		{"duplicate transaction", func() *Block {
+			tx := spend()
+			return block(coinbase(), tx, tx)
+		}(), ErrDuplicateTransaction},
+		{"copy of an unspent coinbase", block(tip.Transactions[0]), ErrDuplicateTransaction},
+		{"first transaction not a coinbase", block(spend()), ErrFirstTxNotCoinbase},
+		{"second coinbase", block(coinbase(), coinbase()), ErrMultipleCoinbases},
+		{"too much coinbase value", block(CoinbaseTx(string(w.Address()), "", chain.Params.BlockSubsidy(height)+1)), ErrBadCoinbaseValue},
+		{"negative output", block(coinbase(), resigned(func(tx *Transaction) { tx.Outputs[0].Value = -1 })), ErrBadOutputValue},
+		{"missing input", func() *Block {
+			tx := spend()
+			tx.Inputs[0].Output = 1
+			tx.ID = tx.expectedID()
+			return block(coinbase(), tx)
+		}(), ErrMissingInput},
+		{"double spend within the block", block(coinbase(), spend(), spend()), ErrDoubleSpend},
+		{"bad signature", func() *Block {
+			tx := spend()
+			tx.Inputs[0].ScriptSig[10] ^= 0xff
+			return block(coinbase(), tx)
+		}(), ErrBadSignature},
+		{"spending more than the inputs", block(coinbase(), resigned(func(tx *Transaction) { tx.Outputs[0].Value++ })), ErrSpendTooHigh},
+		{"timestamp at the median time past", changed(func(b *Block) { b.Timestamp = medianTime }, coinbase()), ErrTimeTooOld},
+		{"timestamp too far in the future", changed(func(b *Block) { b.Timestamp = chain.now().Add(MaxFutureBlockTime + time.Second).Unix() }, coinbase()), ErrTimeTooNew},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if code := ruleErrorCode(t, chain.AddBlock(test.block)); code != test.err {
+				t.Fatalf("expected %s, got %s", test.err, code)
+			}
+			checkTip(t, chain, tip)
+		})
+	}
+
+	// and without breaking any rule, the block is accepted
+	valid := block(coinbase(), spend())
+	addBlocks(t, chain, valid)
+	checkTip(t, chain, valid)
+}
+
+func TestCheckpointedSignatures(t *testing.T) {
+	// a branch whose first block spends the wallet's output with a forged signature
+	setup := func(t *testing.T) (*BlockChain, []*Block) {
+		chain, w := newFundedTestChain(t)
+		chain.SkipCheckpointedSignatures = true
+
+		forged := newSpend(t, chain, w)
+		forged.Inputs[0].ScriptSig[10] ^= 0xff
+
+		tip := tipBlock(t, chain)
+		first := buildBlock(t, chain, tip, newCoinbase(chain, tip.Height+1), forged)
+
+		return chain, append([]*Block{first}, buildBranch(t, chain, first, 2)...)
+	}
+
+	t.Run("fork below the checkpoint", func(t *testing.T) {
+		chain, branch := setup(t)
+		tip := tipBlock(t, chain)
+
+		// the checkpointed block is on another branch, so nothing tells the forged branch leads up to it
+		checkpointed := buildBranch(t, chain, tip, 5)[4]
+		chain.Params.Checkpoints = []params.Checkpoint{{Height: checkpointed.Height, Hash: hex.EncodeToString(checkpointed.Hash)}}
+
+		for _, block := range branch[1:] {
+			if orphan, err := chain.ProcessBlock(block, "peer"); err != nil || !orphan {
+				t.Fatalf("expected block %d to be held as an orphan, got %v", block.Height, err)
+			}
+		}
+
+		if _, err := chain.ProcessBlock(branch[0], "peer"); ruleErrorCode(t, err) != ErrBadSignature {
+			t.Fatalf("expected %s, got %v", ErrBadSignature, err)
+		}
+		checkTip(t, chain, tip)
+	})
+
+	t.Run("blocks leading up to the checkpoint", func(t *testing.T) {
+		chain, branch := setup(t)
+
+		checkpointed := branch[len(branch)-1]
+		chain.Params.Checkpoints = []params.Checkpoint{{Height: checkpointed.Height, Hash: hex.EncodeToString(checkpointed.Hash)}}
+
+		// the checkpointed block arrives first, and vouches for its ancestors as they follow
+		for i := len(branch) - 1; i > 0; i-- {
+			if orphan, err := chain.ProcessBlock(branch[i], "peer"); err != nil || !orphan {
+				t.Fatalf("expected block %d to be held as an orphan, got %v", branch[i].Height, err)
+			}
+		}
+
+		if _, err := chain.ProcessBlock(branch[0], "peer"); err != nil {
+			t.Fatal(err)
+		}
+		checkTip(t, chain, checkpointed)
+	})
+}
+
+func TestValidateTransactionOutputValues(t *testing.T) {
+	chain, w := newFundedTestChain(t)
+
+	tests := []struct {
+		name  string
+		value int
+	}{
+		{"negative output", -1},
+		{"output above the max supply", chain.Params.MaxSupply + 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tx := newSpend(t, chain, w)
+			tx.Outputs[0].Value = test.value
+			resign(chain, w, tx)
+
+			if _, err := chain.ValidateTransaction(tx); ruleErrorCode(t, err) != ErrBadOutputValue {
+				t.Fatalf("expected %s, got %v", ErrBadOutputValue, err)
+			}
+		})
+	}
+}
+
+func TestCoinbaseClaimsFees(t *testing.T) {
+	chain, w := newFundedTestChain(t)
+	tip := tipBlock(t, chain)
+
+	const fee = 3
+	tx := NewTransaction(w, string(wallet.MakeWallet().Address()), 5, fee, &UTXOSet{chain})
+	subsidy := chain.Params.BlockSubsidy(tip.Height + 1)
+
+	template, err := chain.NewBlockTemplate([]*Transaction{tx})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if template.Fees != fee || template.CoinbaseValue != subsidy+fee {
+		t.Fatalf("expected the template to collect a fee of %d for a coinbase of %d, got %d for %d", fee, subsidy+fee, template.Fees, template.CoinbaseValue)
+	}
+
+	// the coinbase may claim the subsidy and the fee, but not a token more
+	claiming := func(value int) *Block {
+		return buildBlock(t, chain, tip, CoinbaseTx(string(w.Address()), "", value), tx)
+	}
+
+	if code := ruleErrorCode(t, chain.AddBlock(claiming(subsidy+fee+1))); code != ErrBadCoinbaseValue {
+		t.Fatalf("expected %s, got %s", ErrBadCoinbaseValue, code)
+	}
+	checkTip(t, chain, tip)
+
+	block := claiming(subsidy + fee)
+	addBlocks(t, chain, block)
+	checkTip(t, chain, block)
+}
+
+func TestCoinbaseMaturity(t *testing.T) {
+	chain, w := newTestChain(t, params.RegTest, &fakeClock{time.Now()})
+	maturity := chain.Params.CoinbaseMaturity
+
+	// the genesis reward can be spent in the next block
+	blocks, err := chain.GenerateBlocks(maturity-1, string(wallet.MakeWallet().Address()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tip := blocks[len(blocks)-1]
+	spend := newSpend(t, chain, w)
+
+	// one block earlier, on a branch forking off below the tip, it's still immature
+	early := buildBlock(t, chain, blocks[len(blocks)-2], newCoinbase(chain, tip.Height), spend)
+	if code := ruleErrorCode(t, chain.AddBlock(early)); code != ErrImmatureSpend {
+		t.Fatalf("expected spending the reward at depth %d to fail with %s, got %s", maturity-1, ErrImmatureSpend, code)
+	}
+	checkTip(t, chain, tip)
+
+	block := buildBlock(t, chain, tip, newCoinbase(chain, tip.Height+1), spend)
+	addBlocks(t, chain, block)
+	checkTip(t, chain, block)
+}
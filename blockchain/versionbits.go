@@ -0,0 +1,248 @@
+package blockchain
+
+import (
+	"fmt"
+	"golang-blockchain/params"
+	"sync"
+)
+
+// soft forks are activated BIP9-style: blocks signal readiness for a deployment through a bit of their version,
+// and the deployment's state moves forward once per retarget window, depending on how many blocks signalled
+
+const (
+	VersionBitsTopBits = 0x20000000 // the top bits of a version signalling deployments
+	VersionBitsTopMask = 0xe0000000 // the bits that have to equal VersionBitsTopBits for the other bits to count
+)
+
+// where a deployment is in its activation
+type ThresholdState int
+
+const (
+	ThresholdDefined  ThresholdState = iota // the deployment's start time hasn't been reached yet
+	ThresholdStarted                        // blocks are signalling, but not enough of them yet
+	ThresholdLockedIn                       // enough blocks signalled, the deployment activates with the next window
+	ThresholdActive                         // the deployment's rules are enforced
+	ThresholdFailed                         // the timeout passed before the deployment locked in
+)
+
+var thresholdStateStrings = map[ThresholdState]string{
+	ThresholdDefined:  "defined",
+	ThresholdStarted:  "started",
+	ThresholdLockedIn: "locked-in",
+	ThresholdActive:   "active",
+	ThresholdFailed:   "failed",
+}
+
+func (state ThresholdState) String() string {
+	if s, ok := thresholdStateStrings[state]; ok {
+		return s
+	}
+
+	return fmt.Sprintf("unknown threshold state (%d)", int(state))
+}
+
+// deployment states are only ever computed once for every window, keyed by the deployment and the window's last block
+type thresholdCache struct {
+	mutex  sync.Mutex
+	states map[string]ThresholdState
+}
+
+func (cache *thresholdCache) get(deployment *params.Deployment, hash []byte) (ThresholdState, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	state, ok := cache.states[fmt.Sprintf("%s-%x", deployment.Name, hash)]
+
+	return state, ok
+}
+
+func (cache *thresholdCache) set(deployment *params.Deployment, hash []byte, state ThresholdState) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if cache.states == nil {
+		cache.states = make(map[string]ThresholdState)
+	}
+	cache.states[fmt.Sprintf("%s-%x", deployment.Name, hash)] = state
+}
+
+// check if the version signals the given deployment
+func signals(version int, deployment *params.Deployment) bool {
+	return version&VersionBitsTopMask == VersionBitsTopBits && version&(1<<deployment.Bit) != 0
+}
+
+// the state of the deployment for the block built on top of prevHash
+func (chain *BlockChain) DeploymentState(prevHash []byte, name string) (ThresholdState, error) {
+	deployment, ok := chain.Params.Deployment(name)
+	if !ok {
+		return ThresholdFailed, fmt.Errorf("unknown deployment %q", name)
+	}
+
+	if deployment.StartTime == params.DeploymentAlwaysActive {
+		return ThresholdActive, nil
+	}
+
+	window := chain.Params.RetargetInterval
+
+	// the state only changes at window boundaries, so go back to the last block of the previous window
+	var windows [][]byte
+	hash := prevHash
+	for len(hash) > 0 {
+		block, err := chain.GetBlock(hash)
+		if err != nil {
+			return ThresholdFailed, err
+		}
+
+		if (block.Height+1)%window != 0 {
+			if hash, err = chain.ancestor(&block, block.Height-(block.Height+1)%window); err != nil {
+				return ThresholdFailed, err
+			}
+			continue
+		}
+
+		if _, ok := chain.deployments.get(deployment, hash); ok {
+			break
+		}
+
+		// before the start time, the deployment is defined no matter what came before
+		medianTime, err := chain.CalcPastMedianTime(hash)
+		if err != nil {
+			return ThresholdFailed, err
+		}
+		if medianTime < deployment.StartTime {
+			chain.deployments.set(deployment, hash, ThresholdDefined)
+			break
+		}
+
+		windows = append(windows, hash)
+		hash = block.PrevHash
+	}
+
+	// the first window starts out defined
+	state := ThresholdDefined
+	if len(hash) > 0 {
+		state, _ = chain.deployments.get(deployment, hash)
+	}
+
+	// then walk forward, one window at a time
+	for i := len(windows) - 1; i >= 0; i-- {
+		next, err := chain.nextThresholdState(deployment, windows[i], state)
+		if err != nil {
+			return ThresholdFailed, err
+		}
+
+		state = next
+		chain.deployments.set(deployment, windows[i], state)
+	}
+
+	return state, nil
+}
+
+// the state the deployment moves to after the window ending with the given block
+func (chain *BlockChain) nextThresholdState(deployment *params.Deployment, hash []byte, state ThresholdState) (ThresholdState, error) {
+	medianTime, err := chain.CalcPastMedianTime(hash)
+	if err != nil {
+		return state, err
+	}
+
+	switch state {
+	case ThresholdDefined:
+		if medianTime >= deployment.Timeout {
+			return ThresholdFailed, nil
+		}
+		if medianTime >= deployment.StartTime {
+			return ThresholdStarted, nil
+		}
+
+	case ThresholdStarted:
+		if medianTime >= deployment.Timeout {
+			return ThresholdFailed, nil
+		}
+
+		// count the window's signalling blocks
+		count := 0
+		for range chain.Params.RetargetInterval {
+			block, err := chain.GetBlock(hash)
+			if err != nil {
+				return state, err
+			}
+
+			if signals(block.Version, deployment) {
+				count++
+			}
+			hash = block.PrevHash
+		}
+
+		if count >= chain.Params.ActivationThreshold {
+			return ThresholdLockedIn, nil
+		}
+
+	case ThresholdLockedIn:
+		return ThresholdActive, nil
+	}
+
+	return state, nil
+}
+
+// check if the deployment's rules apply to the block built on top of prevHash
+func (chain *BlockChain) IsDeploymentActive(prevHash []byte, name string) bool {
+	state, err := chain.DeploymentState(prevHash, name)
+
+	return err == nil && state == ThresholdActive
+}
+
+// check if the deployment's rules apply to the block at the given height of the main chain
+func (chain *BlockChain) IsDeploymentActiveAt(height int, name string) bool {
+	if height <= 0 {
+		return chain.IsDeploymentActive(nil, name)
+	}
+
+	tip, err := chain.GetBlock(chain.LastHash)
+	if err != nil {
+		return false
+	}
+
+	parent, err := chain.ancestor(&tip, height-1)
+	if err != nil {
+		return false
+	}
+
+	return chain.IsDeploymentActive(parent, name)
+}
+
+// the version a block built on top of prevHash should carry, signalling every deployment that is started or locked in
+func (chain *BlockChain) CalcNextBlockVersion(prevHash []byte) (int, error) {
+	version := VersionBitsTopBits
+
+	for i := range chain.Params.Deployments {
+		deployment := &chain.Params.Deployments[i]
+
+		state, err := chain.DeploymentState(prevHash, deployment.Name)
+		if err != nil {
+			return 0, err
+		}
+
+		if state == ThresholdStarted || state == ThresholdLockedIn {
+			version |= 1 << deployment.Bit
+		}
+	}
+
+	return version, nil
+}
+
+// the hash of the block's ancestor at the given height, or nil below the genesis block
+func (chain *BlockChain) ancestor(block *Block, height int) ([]byte, error) {
+	if height < 0 {
+		return nil, nil
+	}
+
+	for block.Height > height {
+		parent, err := chain.GetBlock(block.PrevHash)
+		if err != nil {
+			return nil, err
+		}
+		block = &parent
+	}
+
+	return block.Hash, nil
+}
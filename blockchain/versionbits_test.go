@@ -0,0 +1,82 @@
+package blockchain
+
+import (
+	"golang-blockchain/params"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDeploymentStates(t *testing.T) {
+	start := time.Now().Truncate(time.Second)
+	spacing := 10 * time.Minute
+	at := func(blocks int) int64 {
+		return start.Add(time.Duration(blocks) * spacing).Unix()
+	}
+
+	// regtest windows are 10 blocks long and lock a deployment in once 8 of them signal
+	// with a block every 10 minutes, the median time past at the end of window n, block 10n+9, is the time of block 10n+4
+	chainParams := params.RegTest
+	chainParams.Deployments = []params.Deployment{
+		// starts in the second window and gets signalled by every block from then on
+		{Name: "activates", Bit: 1, StartTime: at(10), Timeout: math.MaxInt64},
+		// starts along with it, but times out before the window it started in is over
+		{Name: "fails", Bit: 2, StartTime: at(10), Timeout: at(20)},
+	}
+
+	clock := &fakeClock{start}
+	chain, w := newTestChain(t, chainParams, clock)
+
+	hashes := [][]byte{chain.LastHash}
+	for height := 1; height <= 45; height++ {
+		clock.now = start.Add(time.Duration(height) * spacing)
+
+		blocks, err := chain.GenerateBlocks(1, string(w.Address()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, blocks[0].Hash)
+	}
+
+	tests := []struct {
+		deployment string
+		from, to   int // the heights of the blocks the state applies to
+		state      ThresholdState
+	}{
+		{"activates", 1, 19, ThresholdDefined},
+		{"activates", 20, 29, ThresholdStarted},
+		{"activates", 30, 39, ThresholdLockedIn},
+		{"activates", 40, 45, ThresholdActive},
+		{"fails", 1, 19, ThresholdDefined},
+		{"fails", 20, 29, ThresholdStarted},
+		{"fails", 30, 45, ThresholdFailed},
+	}
+
+	for _, test := range tests {
+		deployment, _ := chain.Params.Deployment(test.deployment)
+
+		for height := test.from; height <= test.to; height++ {
+			state, err := chain.DeploymentState(hashes[height-1], test.deployment)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state != test.state {
+				t.Errorf("%s at height %d: expected %s, got %s", test.deployment, height, test.state, state)
+			}
+
+			// blocks signal the deployments that are started or locked in
+			block, err := chain.GetBlock(hashes[height])
+			if err != nil {
+				t.Fatal(err)
+			}
+			signalling := test.state == ThresholdStarted || test.state == ThresholdLockedIn
+			if signals(block.Version, deployment) != signalling {
+				t.Errorf("%s at height %d: block version %08x, expected signalling to be %t", test.deployment, height, block.Version, signalling)
+			}
+
+			if active := chain.IsDeploymentActive(hashes[height-1], test.deployment); active != (test.state == ThresholdActive) {
+				t.Errorf("%s at height %d: expected IsDeploymentActive to be %t", test.deployment, height, !active)
+			}
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package blockchain
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"golang-blockchain/wallet"
+	"slices"
+
+	"github.com/dgraph-io/badger"
+)
+
+// an unspent output locked with a vesting script
+type VestingOutput struct {
+	TxID     []byte
+	Index    int
+	Value    int
+	LockTime uint32
+}
+
+// create a new transaction locking amount tokens to the given address in tranches, one vesting at each lock time
+// the tokens are split evenly between the tranches, the last one getting what's left of the split
+func NewVestingTransaction(w *wallet.Wallet, to string, amount, fee int, lockTimes []uint32, UTXO *UTXOSet) (*Transaction, error) {
+	publicKeyHash, ok := LockingScript(to).PublicKeyHash()
+	if !ok {
+		return nil, errors.New("tokens can only vest to the address of a key")
+	}
+
+	if len(lockTimes) == 0 || amount < len(lockTimes) {
+		return nil, fmt.Errorf("can't split %d tokens into %d tranches", amount, len(lockTimes))
+	}
+
+	var tranches []TransactionOutput
+	for i, lockTime := range lockTimes {
+		value := amount / len(lockTimes)
+		if i == len(lockTimes)-1 {
+			value = amount - value*(len(lockTimes)-1)
+		}
+
+		tranches = append(tranches, TransactionOutput{value, VestingScript(lockTime, publicKeyHash)})
+	}
+
+	return newTransaction(w, tranches, fee, UTXO), nil
+}
+
+// create a new transaction claiming the wallet's vested tokens, sending them back to its address, minus the fee
+// heights and times can't be mixed in a lock time, so if tranches of both kinds vested, only those of the kind of the first found are claimed
+func NewClaimTransaction(w *wallet.Wallet, fee int, UTXO *UTXOSet) (*Transaction, error) {
+	chain := UTXO.Blockchain
+
+	var inputs []TransactionInput
+	var lockTime uint32
+	claimed := 0
+
+	for _, out := range UTXO.FindVestingOutputs(wallet.PublicKeyHash(w.PublicKey)) {
+		reached, err := chain.IsLockTimeReached(out.LockTime)
+		if err != nil {
+			return nil, err
+		}
+
+		if !reached || (len(inputs) > 0 && (out.LockTime < LockTimeThreshold) != (lockTime < LockTimeThreshold)) {
+			continue
+		}
+
+		// the sequence must not be final, or the lock time wouldn't apply
+		inputs = append(inputs, TransactionInput{out.TxID, out.Index, nil, 0})
+		lockTime = max(lockTime, out.LockTime)
+		claimed += out.Value
+	}
+
+	if len(inputs) == 0 {
+		return nil, errors.New("no tokens have vested yet")
+	}
+
+	if claimed <= fee {
+		return nil, fmt.Errorf("the %d vested tokens don't cover the fee", claimed)
+	}
+
+	from := fmt.Sprintf("%s", w.Address())
+	tx := Transaction{nil, inputs, []TransactionOutput{*NewTransactionOutput(claimed-fee, from)}, lockTime}
+	tx.ID = tx.hash()
+	chain.SignTransaction(&tx, w.PrivateKey)
+
+	return &tx, nil
+}
+
+// whether a transaction with the lock time may be mined in the next block
+func (chain *BlockChain) IsLockTimeReached(lockTime uint32) (bool, error) {
+	tip, err := chain.GetBlock(chain.LastHash)
+	if err != nil {
+		return false, err
+	}
+
+	medianTime, err := chain.CalcPastMedianTime(tip.Hash)
+	if err != nil {
+		return false, err
+	}
+
+	return lockTimeReached(lockTime, tip.Height+1, medianTime), nil
+}
+
+// locate the unspent outputs vesting to the public key hash, vested or not, ordered by lock time
+func (u *UTXOSet) FindVestingOutputs(publicKeyHash []byte) []VestingOutput {
+	var vesting []VestingOutput
+
+	err := u.Blockchain.Database.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(UTXOPrefix); it.ValidForPrefix(UTXOPrefix); it.Next() {
+			item := it.Item()
+			txID := bytes.TrimPrefix(item.KeyCopy(nil), UTXOPrefix)
+
+			var val []byte
+			err := item.Value(func(v []byte) error {
+				// this func with val would only be called if item.Value() encounters no error.
+				val = slices.Clone(v)
+				return nil
+			})
+			Handle(err)
+
+			outs := DeserializeOutputs(val)
+			for outIdx, out := range outs.Outputs {
+				lockTime, lockedTo, ok := out.ScriptPubKey.Vesting()
+				if ok && bytes.Equal(lockedTo, publicKeyHash) {
+					vesting = append(vesting, VestingOutput{txID, outIdx, out.Value, lockTime})
+				}
+			}
+		}
+
+		return nil
+	})
+	Handle(err)
+
+	slices.SortFunc(vesting, func(a, b VestingOutput) int {
+		return cmp.Compare(a.LockTime, b.LockTime)
+	})
+
+	return vesting
+}
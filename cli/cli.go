@@ -1,15 +1,24 @@
 package cli
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"runtime"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"golang-blockchain/blockchain"
 	"golang-blockchain/network"
+	"golang-blockchain/params"
+	"golang-blockchain/pool"
 	"golang-blockchain/wallet"
 )
 
@@ -17,14 +26,35 @@ type CommandLine struct{}
 
 func (cli *CommandLine) printUsage() {
 	fmt.Println("Usage: ")
+	fmt.Println("   (the NETWORK env variable selects mainnet, testnet, regtest or a custom JSON profile; defaults to mainnet)")
 	fmt.Println("   getbalance -address ADDRESS —— get the balance for the given ADDRESS")
-	fmt.Println("   createblockchain -address ADDRESS —— create a fresh blockchain and have the ADDRESS mine the genesis block")
-	fmt.Println("   send -from FROM -to TO -amount AMOUNT -mine —— Send amount of coins. If -mine flag is set, mine off of this node")
+	fmt.Println("   createblockchain -address ADDRESS -consensus pow|scrypt|poa -signers ADDRESSES —— create a fresh blockchain and have the ADDRESS mine the genesis block. With poa, blocks are signed by the comma separated SIGNERS (defaults to ADDRESS)")
+	fmt.Println("   send -from FROM -to TO -amount AMOUNT -fee FEE -mine -bare —— Send amount of coins, paying FEE to the miner. If -mine flag is set, mine off of this node. If -bare is set, TO is a multisig address of the wallet file and the coins are locked with its bare multisig script")
+	fmt.Println("   vest -from FROM -to TO -amount AMOUNT -until LOCKTIMES -fee FEE -mine —— lock AMOUNT coins to TO in equal tranches, vesting once the chain is past each of the comma separated LOCKTIMES, heights or unix times from 500000000 on")
+	fmt.Println("   claimvested -address ADDRESS -fee FEE -mine —— send the vested coins of ADDRESS back to it, so they can be spent as any others")
+	fmt.Println("   htlc-create -from FROM -to TO -amount AMOUNT -locktime LOCKTIME -hash HASH -fee FEE -out FILE -node NODE -mine —— lock AMOUNT coins in a contract TO redeems with the secret hashing to the hex SHA-256 HASH, and FROM gets back once the chain is past LOCKTIME. Without -hash a new secret is made. The contract is written to FILE. Without -mine the transaction is sent to NODE, the central node by default")
+	fmt.Println("   htlc-audit -contract FILE —— print the terms of the contract and whether it's funded on this chain")
+	fmt.Println("   htlc-redeem -contract FILE -secret SECRET -address ADDRESS -fee FEE -node NODE -mine —— redeem the contract with the hex SECRET, to its recipient or ADDRESS, sending the transaction to NODE")
+	fmt.Println("   htlc-refund -contract FILE -address ADDRESS -fee FEE -node NODE -mine —— get the coins of the contract back once its lock time passed, to its sender or ADDRESS, sending the transaction to NODE")
+	fmt.Println("   htlc-secret -contract FILE —— print the secret revealed by redeeming the contract on this chain")
+	fmt.Println("   notarize -file PATH -address ADDRESS -fee FEE -mine —— anchor the SHA-256 of the file at PATH on the chain, in a data output paid for by ADDRESS")
+	fmt.Println("   verify-notarization -file PATH —— print the block the SHA-256 of the file at PATH was first anchored in")
 	fmt.Println("   printchain —— prints the blocks in the blockchain")
 	fmt.Println("   createwallet —— create a new wallet")
-	fmt.Println("   listaddresses —— list the addresses in the wallet file")
+	fmt.Println("   listaddresses -keys —— list the addresses in the wallet file, along with their public keys if -keys is set")
+	fmt.Println("   createmultisig -required M -keys KEYS —— create an address whose coins take signatures of M of the comma separated KEYS to spend, each a hex public key or an address of the wallet file")
+	fmt.Println("   createmultisigtx -from ADDRESS -to TO -amount AMOUNT -fee FEE -out FILE —— write an unsigned transaction spending coins of the multisig ADDRESS to FILE")
+	fmt.Println("   signmultisigtx -in FILE -address ADDRESS -out FILE —— sign the multisig transaction with the wallet of ADDRESS, or every wallet of the file holding one of its keys")
+	fmt.Println("   combinemultisigtx -in FILES -out FILE —— merge the signatures of the comma separated copies of a multisig transaction")
+	fmt.Println("   sendmultisigtx -in FILE -miner ADDRESS —— complete the signed multisig transaction and send it, or mine it on this node paying the reward to ADDRESS")
 	fmt.Println("   reindexutxo —— rebuild the UTXO set")
-	fmt.Println("   startnode -miner ADDRESS —— Start a node with ID specified in NODE_ID .env variable; miner enables mining")
+	fmt.Println("   startnode -miner ADDRESS -fastsync -rpc HOST:PORT —— Start a node with ID specified in NODE_ID .env variable; miner enables mining; fastsync skips verifying signatures up to the last checkpoint; rpc serves getblocktemplate and submitblock to external miners")
+	fmt.Println("   mine -rpc URL -address ADDRESS —— mine blocks paying their rewards to ADDRESS, using the mining interface of the node at URL")
+	fmt.Println("   startpool -rpc URL -listen HOST:PORT -address ADDRESS -sharebits N -window N —— run a mining pool for the node at URL, paying every block's reward to the miners of the last N shares and what's left to ADDRESS")
+	fmt.Println("   poolmine -pool HOST:PORT -address ADDRESS -worker NAME —— mine for the pool at HOST:PORT, getting paid to ADDRESS")
+	fmt.Println("   generate -blocks N -address ADDRESS —— instantly mine N blocks paying their rewards to ADDRESS (regtest only)")
+	fmt.Println("   deployments —— print the activation state of every soft fork deployment for the next block")
+	fmt.Println("   supply -height HEIGHT —— print the block subsidy and the total issued supply at HEIGHT (defaults to the chain's tip)")
 }
 
 func (cli *CommandLine) getBalance(address string, nodeID string) {
@@ -36,39 +66,98 @@ func (cli *CommandLine) getBalance(address string, nodeID string) {
 	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
 	defer chain.Database.Close()
 
-	amount := 0
-	publicKeyHash := wallet.Base58Decode([]byte(address))
-	publicKeyHash = publicKeyHash[1 : len(publicKeyHash)-4]
-	UTXOs := UTXOSet.FindUTXO(publicKeyHash)
+	amount, immature := UTXOSet.FindBalance(lockingScripts(address, nodeID))
 
-	for _, UTXO := range UTXOs {
-		amount += UTXO.Value
+	vested, vesting := 0, 0
+	if publicKeyHash, ok := blockchain.LockingScript(address).PublicKeyHash(); ok {
+		for _, out := range UTXOSet.FindVestingOutputs(publicKeyHash) {
+			reached, err := chain.IsLockTimeReached(out.LockTime)
+			blockchain.Handle(err)
+
+			if reached {
+				vested += out.Value
+			} else {
+				vesting += out.Value
+				fmt.Printf("%d tokens vest once the chain is past %d\n", out.Value, out.LockTime)
+			}
+		}
 	}
 
 	fmt.Printf("--------\n")
 	fmt.Printf("Address %s has %d tokens\n", address, amount)
+	if immature > 0 {
+		fmt.Printf("Another %d tokens of mining rewards are still maturing\n", immature)
+	}
+	if vested > 0 {
+		fmt.Printf("Another %d tokens have vested, claim them with claimvested\n", vested)
+	}
+	if vesting > 0 {
+		fmt.Printf("Another %d tokens are still vesting\n", vesting)
+	}
 	fmt.Printf("--------\n")
 }
 
-func (cli *CommandLine) createBlockChain(address, nodeID string) {
+// the scripts the address' coins can be locked with: its standard one, and for the multisig addresses
+// the wallet file keeps track of, the bare multisig script too
+func lockingScripts(address, nodeID string) []blockchain.Script {
+	scripts := []blockchain.Script{blockchain.LockingScript(address)}
+
+	wallets, _ := wallet.CreateWallets(nodeID)
+	if script, ok := wallets.GetMultisig(address); ok {
+		scripts = append(scripts, script)
+	}
+
+	return scripts
+}
+
+func (cli *CommandLine) createBlockChain(address, consensus, signers, nodeID string) {
 	if !wallet.ValidateAddress(address) {
 		log.Panic("Address is invalid")
 	}
 
-	chain := blockchain.CreateBlockChain(address, nodeID)
-	chain.Database.Close()
+	config := blockchain.ConsensusConfig{Engine: consensus}
+	var signer *wallet.Wallet
 
-	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
-	UTXOSet.Reindex()
+	if consensus == blockchain.EnginePoa {
+		// the genesis block is sealed by the address' own key, so it has to be an authority too
+		if signers == "" {
+			signers = address
+		}
+
+		for _, signerAddress := range strings.Split(signers, ",") {
+			if !wallet.ValidateAddress(signerAddress) || wallet.IsScriptAddress(signerAddress) {
+				log.Panic("Signer address is invalid")
+			}
+
+			publicKeyHash := wallet.Base58Decode([]byte(signerAddress))
+			config.Signers = append(config.Signers, publicKeyHash[1:len(publicKeyHash)-4])
+		}
+
+		wallets, err := wallet.CreateWallets(nodeID)
+		blockchain.Handle(err)
+
+		w, ok := wallets.Wallets[address]
+		if !ok {
+			log.Panic("The address' wallet is needed to seal the genesis block")
+		}
+		signer = w
+	}
+
+	chain := blockchain.CreateBlockChain(address, nodeID, config, signer)
+	chain.Database.Close()
 
 	fmt.Println("blockchain created!")
 }
 
-func (cli *CommandLine) send(from, to string, amount int, nodeID string, mineNow bool) {
+func (cli *CommandLine) send(from, to string, amount, fee int, nodeID string, mineNow, bare bool) {
 	if !wallet.ValidateAddress(from) {
 		log.Panic("Address is invalid")
 	}
 
+	if wallet.IsScriptAddress(from) {
+		log.Panic("Coins of multisig addresses are spent with createmultisigtx")
+	}
+
 	if !wallet.ValidateAddress(to) {
 		log.Panic("Address is invalid")
 	}
@@ -83,18 +172,341 @@ func (cli *CommandLine) send(from, to string, amount int, nodeID string, mineNow
 	}
 	wallet := wallets.GetWallet(from)
 
-	tx := blockchain.NewTransaction(&wallet, to, amount, &UTXOSet)
+	toScript := blockchain.LockingScript(to)
+	if bare {
+		script, ok := wallets.GetMultisig(to)
+		if !ok {
+			log.Panic("The wallet file doesn't keep track of the multisig address")
+		}
+		toScript = script
+	}
+
+	tx := blockchain.NewScriptTransaction(&wallet, toScript, amount, fee, &UTXOSet)
+	if mineNow {
+		mineTransaction(chain, tx, from, fee, &wallet)
+	} else {
+		network.SendTransaction(network.CentralNode(), tx)
+		fmt.Println("Sent transaction")
+	}
+
+	fmt.Printf("Sent %d tokens to %s, paying a fee of %d\n", amount, to, fee)
+}
+
+// the node a transaction is sent to, the profile's central node unless another one is given
+func txNode(node string) string {
+	if node == "" {
+		return network.CentralNode()
+	}
+
+	return node
+}
+
+// mine a block holding the transaction on this node, paying the reward and the fee to the miner's address
+// authority engines seal the block with the given wallet's key
+func mineTransaction(chain *blockchain.BlockChain, tx *blockchain.Transaction, miner string, fee int, w *wallet.Wallet) {
+	chain.Hashrate = func(hashesPerSecond float64) {
+		fmt.Printf("Mining at %.2f kH/s\n", hashesPerSecond/1000)
+	}
+
+	if authorizer, ok := chain.Engine.(blockchain.Authorizer); ok {
+		if w == nil {
+			log.Panic("The miner's wallet is needed to seal the block")
+		}
+		blockchain.Handle(authorizer.Authorize(w))
+	}
+
+	// mining the transaction ourselves means we also collect its fee
+	cbTx := blockchain.CoinbaseTx(miner, "", chain.Params.BlockSubsidy(chain.GetBestHeight()+1)+fee)
+	txs := []*blockchain.Transaction{cbTx, tx}
+	chain.MineBlock(txs)
+}
+
+func (cli *CommandLine) vest(from, to string, amount, fee int, until string, nodeID string, mineNow bool) {
+	if !wallet.ValidateAddress(from) || wallet.IsScriptAddress(from) {
+		log.Panic("Address is invalid")
+	}
+
+	if !wallet.ValidateAddress(to) || wallet.IsScriptAddress(to) {
+		log.Panic("Address is invalid")
+	}
+
+	var lockTimes []uint32
+	for _, lockTime := range strings.Split(until, ",") {
+		n, err := strconv.ParseUint(lockTime, 10, 32)
+		if err != nil || n == 0 {
+			log.Panic("Lock time is invalid: ", lockTime)
+		}
+		lockTimes = append(lockTimes, uint32(n))
+	}
+
+	chain := blockchain.ContinueBlockChain(nodeID)
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	defer chain.Database.Close()
+
+	wallets, err := wallet.CreateWallets(nodeID)
+	blockchain.Handle(err)
+	w := wallets.GetWallet(from)
+
+	tx, err := blockchain.NewVestingTransaction(&w, to, amount, fee, lockTimes, &UTXOSet)
+	blockchain.Handle(err)
+
+	if mineNow {
+		mineTransaction(chain, tx, from, fee, &w)
+	} else {
+		network.SendTransaction(network.CentralNode(), tx)
+		fmt.Println("Sent transaction")
+	}
+
+	fmt.Printf("Locked %d tokens to %s in %d tranches, paying a fee of %d\n", amount, to, len(lockTimes), fee)
+}
+
+func (cli *CommandLine) claimVested(address string, fee int, nodeID string, mineNow bool) {
+	if !wallet.ValidateAddress(address) || wallet.IsScriptAddress(address) {
+		log.Panic("Address is invalid")
+	}
+
+	chain := blockchain.ContinueBlockChain(nodeID)
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	defer chain.Database.Close()
+
+	wallets, err := wallet.CreateWallets(nodeID)
+	blockchain.Handle(err)
+	w := wallets.GetWallet(address)
+
+	tx, err := blockchain.NewClaimTransaction(&w, fee, &UTXOSet)
+	blockchain.Handle(err)
+
+	if mineNow {
+		mineTransaction(chain, tx, address, fee, &w)
+	} else {
+		network.SendTransaction(network.CentralNode(), tx)
+		fmt.Println("Sent transaction")
+	}
+
+	fmt.Printf("Claimed %d vested tokens, paying a fee of %d\n", tx.Outputs[0].Value+fee, fee)
+}
+
+func (cli *CommandLine) htlcCreate(from, to string, amount, fee int, lockTime uint, hash, out, node, nodeID string, mineNow bool) {
+	if !wallet.ValidateAddress(from) || wallet.IsScriptAddress(from) {
+		log.Panic("Address is invalid")
+	}
+
+	if !wallet.ValidateAddress(to) || wallet.IsScriptAddress(to) {
+		log.Panic("Address is invalid")
+	}
+
+	if lockTime == 0 || lockTime > math.MaxUint32 {
+		log.Panic("Lock time is invalid")
+	}
+
+	// whoever starts the swap picks the secret, the other side reuses its hash
+	var secretHash []byte
+	if hash == "" {
+		secret := make([]byte, 32)
+		_, err := rand.Read(secret)
+		blockchain.Handle(err)
+
+		sum := sha256.Sum256(secret)
+		secretHash = sum[:]
+		fmt.Printf("Secret: %x\n", secret)
+		fmt.Println("Keep the secret to yourself until redeeming the other side of the swap, which reveals it")
+	} else {
+		var err error
+		if secretHash, err = hex.DecodeString(hash); err != nil {
+			log.Panic("Hash is invalid: ", hash)
+		}
+	}
+
+	chain := blockchain.ContinueBlockChain(nodeID)
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	defer chain.Database.Close()
+
+	wallets, err := wallet.CreateWallets(nodeID)
+	blockchain.Handle(err)
+	w := wallets.GetWallet(from)
+
+	contract, tx, err := blockchain.NewHTLCContract(&w, to, secretHash, uint32(lockTime), amount, fee, &UTXOSet)
+	blockchain.Handle(err)
+
+	if mineNow {
+		mineTransaction(chain, tx, from, fee, &w)
+	} else {
+		network.SendTransaction(txNode(node), tx)
+		fmt.Println("Sent transaction")
+	}
+
+	contract.SaveFile(out)
+
+	fmt.Printf("Secret hash: %x\n", secretHash)
+	fmt.Printf("Contract: %s\n", contract.Script)
+	fmt.Printf("Locked %d tokens to %s, redeemable by %s with the secret, refundable once the chain is past %d\n", amount, wallet.ScriptAddress(contract.Script), to, lockTime)
+	fmt.Printf("The contract is written to %s, hand it to %s\n", out, to)
+}
+
+func (cli *CommandLine) htlcAudit(path, nodeID string) {
+	contract, err := blockchain.LoadHTLCContract(path)
+	blockchain.Handle(err)
+
+	secretHash, recipient, refund, lockTime, _ := contract.Script.HTLC()
+
+	chain := blockchain.ContinueBlockChain(nodeID)
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	defer chain.Database.Close()
+
+	fmt.Printf("Contract: %s\n", contract.Script)
+	fmt.Printf("Secret hash: %x\n", secretHash)
+	fmt.Printf("Recipient: %s\n", wallet.KeyHashAddress(recipient))
+	fmt.Printf("Refund to: %s once the chain is past %d\n", wallet.KeyHashAddress(refund), lockTime)
+	fmt.Printf("Value: %d in output %d of transaction %x\n", contract.Value, contract.Output, contract.TxID)
+	fmt.Printf("Funded: %s\n", strconv.FormatBool(UTXOSet.IsHTLCFunded(contract)))
+}
+
+func (cli *CommandLine) htlcRedeem(path, secret, address string, fee int, node, nodeID string, mineNow bool) {
+	contract, err := blockchain.LoadHTLCContract(path)
+	blockchain.Handle(err)
+
+	preimage, err := hex.DecodeString(secret)
+	if err != nil {
+		log.Panic("Secret is invalid: ", secret)
+	}
+
+	// the coins go to the contract's recipient, unless asked for another key of the wallet file
+	if address == "" {
+		_, recipient, _, _, _ := contract.Script.HTLC()
+		address = string(wallet.KeyHashAddress(recipient))
+	}
+
+	chain := blockchain.ContinueBlockChain(nodeID)
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	defer chain.Database.Close()
+
+	if !UTXOSet.IsHTLCFunded(contract) {
+		log.Panic("The contract isn't funded on this chain, or was already spent")
+	}
+
+	wallets, err := wallet.CreateWallets(nodeID)
+	blockchain.Handle(err)
+	w, ok := wallets.Wallets[address]
+	if !ok {
+		log.Panic("The wallet file doesn't hold the address' key")
+	}
+
+	tx, err := contract.Redeem(w, preimage, fee)
+	blockchain.Handle(err)
+
 	if mineNow {
-		cbTx := blockchain.CoinbaseTx(from, "")
-		txs := []*blockchain.Transaction{cbTx, tx}
-		block := chain.MineBlock(txs)
-		UTXOSet.Update(block)
+		mineTransaction(chain, tx, address, fee, w)
 	} else {
-		network.SendTransaction(network.KnownNodes[0], tx)
+		network.SendTransaction(txNode(node), tx)
 		fmt.Println("Sent transaction")
 	}
 
-	fmt.Printf("Sent %d tokens to %s\n", amount, to)
+	fmt.Printf("Redeemed %d tokens to %s, paying a fee of %d\n", contract.Value-fee, address, fee)
+}
+
+func (cli *CommandLine) htlcRefund(path, address string, fee int, node, nodeID string, mineNow bool) {
+	contract, err := blockchain.LoadHTLCContract(path)
+	blockchain.Handle(err)
+
+	if address == "" {
+		_, _, refund, _, _ := contract.Script.HTLC()
+		address = string(wallet.KeyHashAddress(refund))
+	}
+
+	chain := blockchain.ContinueBlockChain(nodeID)
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	defer chain.Database.Close()
+
+	if !UTXOSet.IsHTLCFunded(contract) {
+		log.Panic("The contract isn't funded on this chain, or was already spent")
+	}
+
+	wallets, err := wallet.CreateWallets(nodeID)
+	blockchain.Handle(err)
+	w, ok := wallets.Wallets[address]
+	if !ok {
+		log.Panic("The wallet file doesn't hold the address' key")
+	}
+
+	tx, err := contract.Refund(w, fee, chain)
+	blockchain.Handle(err)
+
+	if mineNow {
+		mineTransaction(chain, tx, address, fee, w)
+	} else {
+		network.SendTransaction(txNode(node), tx)
+		fmt.Println("Sent transaction")
+	}
+
+	fmt.Printf("Refunded %d tokens to %s, paying a fee of %d\n", contract.Value-fee, address, fee)
+}
+
+func (cli *CommandLine) htlcSecret(path, nodeID string) {
+	contract, err := blockchain.LoadHTLCContract(path)
+	blockchain.Handle(err)
+
+	chain := blockchain.ContinueBlockChain(nodeID)
+	defer chain.Database.Close()
+
+	secret, err := chain.FindHTLCSecret(contract)
+	blockchain.Handle(err)
+
+	fmt.Printf("Secret: %x\n", secret)
+}
+
+func (cli *CommandLine) notarize(path, address string, fee int, nodeID string, mineNow bool) {
+	if !wallet.ValidateAddress(address) || wallet.IsScriptAddress(address) {
+		log.Panic("Address is invalid")
+	}
+
+	contents, err := os.ReadFile(path)
+	blockchain.Handle(err)
+	hash := sha256.Sum256(contents)
+
+	chain := blockchain.ContinueBlockChain(nodeID)
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	defer chain.Database.Close()
+
+	wallets, err := wallet.CreateWallets(nodeID)
+	blockchain.Handle(err)
+	w := wallets.GetWallet(address)
+
+	tx, err := blockchain.NewDataTransaction(&w, hash[:], fee, &UTXOSet)
+	blockchain.Handle(err)
+
+	if mineNow {
+		mineTransaction(chain, tx, address, fee, &w)
+	} else {
+		network.SendTransaction(network.CentralNode(), tx)
+		fmt.Println("Sent transaction")
+	}
+
+	fmt.Printf("Anchored the SHA-256 of %s, %x, in transaction %x, paying a fee of %d\n", path, hash, tx.ID, fee)
+}
+
+func (cli *CommandLine) verifyNotarization(path, nodeID string) {
+	contents, err := os.ReadFile(path)
+	blockchain.Handle(err)
+	hash := sha256.Sum256(contents)
+
+	chain := blockchain.ContinueBlockChain(nodeID)
+	defer chain.Database.Close()
+
+	block, tx, err := chain.FindData(hash[:])
+	if err != nil {
+		fmt.Printf("The SHA-256 of %s, %x, hasn't been notarized on this chain\n", path, hash)
+		return
+	}
+
+	fmt.Printf("--------\n")
+	fmt.Printf("File: %s\n", path)
+	fmt.Printf("SHA-256: %x\n", hash)
+	fmt.Printf("Transaction: %x\n", tx.ID)
+	fmt.Printf("Block: %x\n", block.Hash)
+	fmt.Printf("Height: %d\n", block.Height)
+	fmt.Printf("Timestamp: %s\n", time.Unix(block.Timestamp, 0).UTC().Format(time.RFC3339))
+	fmt.Printf("Confirmations: %d\n", chain.GetBestHeight()-block.Height+1)
+	fmt.Printf("--------\n")
 }
 
 func (cli *CommandLine) printChain(nodeID string) {
@@ -108,9 +520,10 @@ func (cli *CommandLine) printChain(nodeID string) {
 		fmt.Printf("--------\n")
 		fmt.Printf("Previous Hash: %x\n", block.PrevHash)
 		fmt.Printf("Current Hash: %x\n", block.Hash)
+		fmt.Printf("Version: %08x\n", block.Version)
 
-		pow := blockchain.NewProof(block)
-		fmt.Printf("Proof-of-work: %s\n", strconv.FormatBool(pow.Validate()))
+		sealed := chain.Engine.VerifyHeader(chain, &block.BlockHeader) == nil
+		fmt.Printf("Valid seal: %s\n", strconv.FormatBool(sealed))
 		for _, tx := range block.Transactions {
 			fmt.Println(tx)
 		}
@@ -131,15 +544,157 @@ func (cli *CommandLine) createWallet(nodeID string) {
 	fmt.Printf("The address of your new wallet: %s\n", address)
 }
 
-func (cli *CommandLine) listAddresses(nodeID string) {
+func (cli *CommandLine) listAddresses(nodeID string, keys bool) {
 	wallets, _ := wallet.CreateWallets(nodeID)
 	addresses := wallets.GetAllAddresses()
 
 	for _, address := range addresses {
-		fmt.Println(address)
+		if keys {
+			fmt.Printf("%s %x\n", address, wallets.GetWallet(address).PublicKey)
+		} else {
+			fmt.Println(address)
+		}
+	}
+
+	for address := range wallets.Multisigs {
+		script, _ := wallets.GetMultisig(address)
+		required, publicKeys, _ := blockchain.Script(script).Multisig()
+		fmt.Printf("%s (%d-of-%d multisig)\n", address, required, len(publicKeys))
 	}
 }
 
+func (cli *CommandLine) createMultisig(required int, keys, nodeID string) {
+	wallets, _ := wallet.CreateWallets(nodeID)
+
+	var publicKeys [][]byte
+	for _, key := range strings.Split(keys, ",") {
+		if w, ok := wallets.Wallets[key]; ok {
+			publicKeys = append(publicKeys, w.PublicKey)
+			continue
+		}
+
+		publicKey, err := hex.DecodeString(key)
+		if err != nil {
+			log.Panic("Key is neither a public key nor an address of the wallet file: ", key)
+		}
+		publicKeys = append(publicKeys, publicKey)
+	}
+
+	script, err := blockchain.MultisigScript(required, publicKeys)
+	blockchain.Handle(err)
+
+	address := wallets.AddMultisig(script)
+	wallets.SaveFile(nodeID)
+
+	fmt.Printf("Multisig script: %s\n", script)
+	fmt.Printf("The address of your new %d-of-%d multisig: %s\n", required, len(publicKeys), address)
+}
+
+func (cli *CommandLine) createMultisigTx(from, to string, amount, fee int, out, nodeID string) {
+	if !wallet.IsScriptAddress(from) || !wallet.ValidateAddress(to) {
+		log.Panic("Address is invalid")
+	}
+
+	wallets, _ := wallet.CreateWallets(nodeID)
+	script, ok := wallets.GetMultisig(from)
+	if !ok {
+		log.Panic("The wallet file doesn't keep track of the multisig address")
+	}
+
+	chain := blockchain.ContinueBlockChain(nodeID)
+	defer chain.Database.Close()
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+
+	multisigTx, err := blockchain.NewMultisigTx(script, to, amount, fee, &UTXOSet)
+	blockchain.Handle(err)
+	multisigTx.SaveFile(out)
+
+	fmt.Printf("Transaction %x needs %d signatures, written to %s\n", multisigTx.Transaction.ID, multisigTx.Required(), out)
+}
+
+func (cli *CommandLine) signMultisigTx(in, address, out, nodeID string) {
+	multisigTx, err := blockchain.LoadMultisigTx(in)
+	blockchain.Handle(err)
+
+	wallets, _ := wallet.CreateWallets(nodeID)
+
+	signers := []string{address}
+	if address == "" {
+		signers = wallets.GetAllAddresses()
+	}
+
+	signed := 0
+	for _, signer := range signers {
+		w, ok := wallets.Wallets[signer]
+		if !ok {
+			log.Panic("The wallet file doesn't hold the address' key")
+		}
+
+		if err := multisigTx.Sign(w.PrivateKey); err != nil {
+			// only the key asked for has to be one of the multisig's
+			if address != "" {
+				log.Panic(err)
+			}
+			continue
+		}
+		signed++
+	}
+
+	if signed == 0 {
+		log.Panic("The wallet file holds none of the multisig's keys")
+	}
+
+	multisigTx.SaveFile(out)
+	fmt.Printf("Signed with %d keys, the transaction has %d of the %d signatures required\n", signed, multisigTx.Signed(), multisigTx.Required())
+}
+
+func (cli *CommandLine) combineMultisigTx(in, out string) {
+	var combined *blockchain.MultisigTx
+
+	for _, path := range strings.Split(in, ",") {
+		multisigTx, err := blockchain.LoadMultisigTx(path)
+		blockchain.Handle(err)
+
+		if combined == nil {
+			combined = multisigTx
+		} else {
+			blockchain.Handle(combined.Combine(multisigTx))
+		}
+	}
+
+	combined.SaveFile(out)
+	fmt.Printf("The transaction has %d of the %d signatures required\n", combined.Signed(), combined.Required())
+}
+
+func (cli *CommandLine) sendMultisigTx(in, miner, nodeID string) {
+	multisigTx, err := blockchain.LoadMultisigTx(in)
+	blockchain.Handle(err)
+
+	tx, err := multisigTx.Finalize()
+	blockchain.Handle(err)
+
+	if miner == "" {
+		network.SendTransaction(network.CentralNode(), tx)
+		fmt.Printf("Sent transaction %x\n", tx.ID)
+		return
+	}
+
+	if !wallet.ValidateAddress(miner) {
+		log.Panic("Address is invalid")
+	}
+
+	chain := blockchain.ContinueBlockChain(nodeID)
+	defer chain.Database.Close()
+
+	// the fee is whatever the outputs leave unclaimed of the inputs
+	fee, err := chain.ValidateTransaction(tx)
+	blockchain.Handle(err)
+
+	wallets, _ := wallet.CreateWallets(nodeID)
+	mineTransaction(chain, tx, miner, fee, wallets.Wallets[miner])
+	fmt.Printf("Mined transaction %x\n", tx.ID)
+}
+
 func (cli *CommandLine) reindexUTXO(nodeID string) {
 	chain := blockchain.ContinueBlockChain(nodeID)
 	defer chain.Database.Close()
@@ -151,7 +706,54 @@ func (cli *CommandLine) reindexUTXO(nodeID string) {
 	fmt.Printf("Done! There are now %d transactions in the UTXO set.\n", count)
 }
 
-func (cli *CommandLine) StartNode(nodeID, minerAddress string) {
+func (cli *CommandLine) generate(blocks int, address, nodeID string) {
+	if !wallet.ValidateAddress(address) {
+		log.Panic("Address is invalid")
+	}
+
+	chain := blockchain.ContinueBlockChain(nodeID)
+	defer chain.Database.Close()
+
+	generated, err := chain.GenerateBlocks(blocks, address)
+	for _, block := range generated {
+		fmt.Printf("%x\n", block.Hash)
+	}
+	blockchain.Handle(err)
+
+	fmt.Printf("Generated %d blocks, the chain's tip is now at height %d\n", len(generated), chain.GetBestHeight())
+}
+
+func (cli *CommandLine) deployments(nodeID string) {
+	chain := blockchain.ContinueBlockChain(nodeID)
+	defer chain.Database.Close()
+
+	fmt.Printf("--------\n")
+	for _, deployment := range chain.Params.Deployments {
+		state, err := chain.DeploymentState(chain.LastHash, deployment.Name)
+		blockchain.Handle(err)
+
+		fmt.Printf("%s (bit %d): %s\n", deployment.Name, deployment.Bit, state)
+	}
+	fmt.Printf("--------\n")
+}
+
+func (cli *CommandLine) supply(height int, nodeID string) {
+	if height < 0 {
+		chain := blockchain.ContinueBlockChain(nodeID)
+		height = chain.GetBestHeight()
+		chain.Database.Close()
+	}
+
+	schedule := params.Active
+
+	fmt.Printf("--------\n")
+	fmt.Printf("Height: %d\n", height)
+	fmt.Printf("Block subsidy: %d tokens\n", schedule.BlockSubsidy(height))
+	fmt.Printf("Total issued supply: %d of %d tokens\n", schedule.TotalSupply(height), schedule.MaxSupply)
+	fmt.Printf("--------\n")
+}
+
+func (cli *CommandLine) StartNode(nodeID, minerAddress string, fastSync bool, rpcAddress string) {
 	fmt.Printf("Starting Node %s\n", nodeID)
 
 	if len(minerAddress) > 0 {
@@ -161,7 +763,40 @@ func (cli *CommandLine) StartNode(nodeID, minerAddress string) {
 			log.Panic("Wrong miner address!")
 		}
 	}
-	network.StartServer(nodeID, minerAddress)
+	if fastSync {
+		fmt.Println("Fast sync is on. Signatures in blocks up to the last checkpoint won't be verified")
+	}
+	if len(rpcAddress) > 0 {
+		fmt.Println("Mining interface is on. Listening on", rpcAddress)
+	}
+	network.StartServer(nodeID, minerAddress, fastSync, rpcAddress)
+}
+
+func (cli *CommandLine) mine(url, address string) {
+	if !wallet.ValidateAddress(address) {
+		log.Panic("Address is invalid")
+	}
+
+	fmt.Printf("Mining with %s. Address to receive rewards: %s\n", url, address)
+	network.RunMiner(strings.TrimSuffix(url, "/"), address)
+}
+
+func (cli *CommandLine) startPool(url, listen, address string, shareBits, window int) {
+	if !wallet.ValidateAddress(address) {
+		log.Panic("Address is invalid")
+	}
+
+	server := pool.NewServer(strings.TrimSuffix(url, "/"), address, shareBits, window)
+	blockchain.Handle(server.ListenAndServe(listen))
+}
+
+func (cli *CommandLine) poolMine(poolAddress, address, worker string) {
+	if !wallet.ValidateAddress(address) {
+		log.Panic("Address is invalid")
+	}
+
+	fmt.Printf("Mining for the pool at %s. Address to receive rewards: %s\n", poolAddress, address)
+	blockchain.Handle(pool.RunWorker(poolAddress, address, worker))
 }
 
 func (cli *CommandLine) validateArgs() {
@@ -180,6 +815,12 @@ func (cli *CommandLine) Run() {
 		runtime.Goexit()
 	}
 
+	if err := params.Select(os.Getenv("NETWORK")); err != nil {
+		fmt.Println("Invalid NETWORK:", err)
+		runtime.Goexit()
+	}
+	network.KnownNodes = slices.Clone(params.Active.SeedNodes)
+
 	getBalanceCmd := flag.NewFlagSet("getbalance", flag.ExitOnError)
 	createBlockChainCmd := flag.NewFlagSet("createblockchain", flag.ExitOnError)
 	sendCmd := flag.NewFlagSet("send", flag.ExitOnError)
@@ -188,14 +829,104 @@ func (cli *CommandLine) Run() {
 	listaddressescmd := flag.NewFlagSet("listaddresses", flag.ExitOnError)
 	reeindexUTXOcmd := flag.NewFlagSet("reindexutxo", flag.ExitOnError)
 	startNodeCmd := flag.NewFlagSet("startnode", flag.ExitOnError)
+	supplyCmd := flag.NewFlagSet("supply", flag.ExitOnError)
+	generateCmd := flag.NewFlagSet("generate", flag.ExitOnError)
+	deploymentsCmd := flag.NewFlagSet("deployments", flag.ExitOnError)
+	mineCmd := flag.NewFlagSet("mine", flag.ExitOnError)
+	startPoolCmd := flag.NewFlagSet("startpool", flag.ExitOnError)
+	poolMineCmd := flag.NewFlagSet("poolmine", flag.ExitOnError)
+	vestCmd := flag.NewFlagSet("vest", flag.ExitOnError)
+	claimVestedCmd := flag.NewFlagSet("claimvested", flag.ExitOnError)
+	htlcCreateCmd := flag.NewFlagSet("htlc-create", flag.ExitOnError)
+	htlcAuditCmd := flag.NewFlagSet("htlc-audit", flag.ExitOnError)
+	htlcRedeemCmd := flag.NewFlagSet("htlc-redeem", flag.ExitOnError)
+	htlcRefundCmd := flag.NewFlagSet("htlc-refund", flag.ExitOnError)
+	htlcSecretCmd := flag.NewFlagSet("htlc-secret", flag.ExitOnError)
+	notarizeCmd := flag.NewFlagSet("notarize", flag.ExitOnError)
+	verifyNotarizationCmd := flag.NewFlagSet("verify-notarization", flag.ExitOnError)
+	createMultisigCmd := flag.NewFlagSet("createmultisig", flag.ExitOnError)
+	createMultisigTxCmd := flag.NewFlagSet("createmultisigtx", flag.ExitOnError)
+	signMultisigTxCmd := flag.NewFlagSet("signmultisigtx", flag.ExitOnError)
+	combineMultisigTxCmd := flag.NewFlagSet("combinemultisigtx", flag.ExitOnError)
+	sendMultisigTxCmd := flag.NewFlagSet("sendmultisigtx", flag.ExitOnError)
 
 	getBalanceAddresss := getBalanceCmd.String("address", "", "The address of the account you want to check the balance on")
 	createBlockChainAddress := createBlockChainCmd.String("address", "", "The address of the account who will mine the genesis block")
+	createBlockChainConsensus := createBlockChainCmd.String("consensus", blockchain.EnginePow, "The consensus engine the chain runs: pow, scrypt or poa")
+	createBlockChainSigners := createBlockChainCmd.String("signers", "", "Comma separated addresses allowed to sign blocks, for poa")
 	sendFrom := sendCmd.String("from", "", "The address of the account you want to send tokens from")
 	sendTo := sendCmd.String("to", "", "The address of the account you want to send tokens to")
 	sendAmount := sendCmd.Int("amount", 0, "The amount of tokens you want to send")
+	sendFee := sendCmd.Int("fee", 0, "The amount of tokens paid to the miner who includes the transaction")
 	sendMine := sendCmd.Bool("mine", false, "Mine immediately on the same node")
+	sendBare := sendCmd.Bool("bare", false, "Lock the tokens with the bare multisig script of TO, a multisig address of the wallet file")
+	vestFrom := vestCmd.String("from", "", "The address of the account you want to send tokens from")
+	vestTo := vestCmd.String("to", "", "The address the tokens vest to")
+	vestAmount := vestCmd.Int("amount", 0, "The amount of tokens to lock")
+	vestUntil := vestCmd.String("until", "", "Comma separated lock times, one per tranche: heights, or unix times from 500000000 on")
+	vestFee := vestCmd.Int("fee", 0, "The amount of tokens paid to the miner who includes the transaction")
+	vestMine := vestCmd.Bool("mine", false, "Mine immediately on the same node")
+	claimVestedAddress := claimVestedCmd.String("address", "", "The address whose vested tokens are claimed")
+	claimVestedFee := claimVestedCmd.Int("fee", 0, "The amount of tokens paid to the miner who includes the transaction")
+	claimVestedMine := claimVestedCmd.Bool("mine", false, "Mine immediately on the same node")
+	htlcCreateFrom := htlcCreateCmd.String("from", "", "The address of the account you want to send tokens from, which gets them back after the lock time")
+	htlcCreateTo := htlcCreateCmd.String("to", "", "The address that can redeem the tokens with the secret")
+	htlcCreateAmount := htlcCreateCmd.Int("amount", 0, "The amount of tokens to lock")
+	htlcCreateLockTime := htlcCreateCmd.Uint("locktime", 0, "The height, or unix time from 500000000 on, after which the tokens can be refunded")
+	htlcCreateHash := htlcCreateCmd.String("hash", "", "The hex SHA-256 of the secret, from the other side of the swap; a new secret is made without it")
+	htlcCreateFee := htlcCreateCmd.Int("fee", 0, "The amount of tokens paid to the miner who includes the transaction")
+	htlcCreateOut := htlcCreateCmd.String("out", "", "The file the contract is written to")
+	htlcCreateMine := htlcCreateCmd.Bool("mine", false, "Mine immediately on the same node")
+	htlcCreateNode := htlcCreateCmd.String("node", "", "The HOST:PORT of a node on the contract's chain the transaction is sent to, defaults to the central node")
+	htlcAuditContract := htlcAuditCmd.String("contract", "", "The file of the contract")
+	htlcRedeemContract := htlcRedeemCmd.String("contract", "", "The file of the contract")
+	htlcRedeemSecret := htlcRedeemCmd.String("secret", "", "The hex secret the contract's hash is of")
+	htlcRedeemAddress := htlcRedeemCmd.String("address", "", "The address the tokens are redeemed to, defaults to the contract's recipient")
+	htlcRedeemFee := htlcRedeemCmd.Int("fee", 0, "The amount of tokens paid to the miner who includes the transaction")
+	htlcRedeemMine := htlcRedeemCmd.Bool("mine", false, "Mine immediately on the same node")
+	htlcRedeemNode := htlcRedeemCmd.String("node", "", "The HOST:PORT of a node on the contract's chain the transaction is sent to, defaults to the central node")
+	htlcRefundContract := htlcRefundCmd.String("contract", "", "The file of the contract")
+	htlcRefundAddress := htlcRefundCmd.String("address", "", "The address the tokens are refunded to, defaults to the contract's sender")
+	htlcRefundFee := htlcRefundCmd.Int("fee", 0, "The amount of tokens paid to the miner who includes the transaction")
+	htlcRefundMine := htlcRefundCmd.Bool("mine", false, "Mine immediately on the same node")
+	htlcRefundNode := htlcRefundCmd.String("node", "", "The HOST:PORT of a node on the contract's chain the transaction is sent to, defaults to the central node")
+	htlcSecretContract := htlcSecretCmd.String("contract", "", "The file of the contract")
+	notarizeFile := notarizeCmd.String("file", "", "The file whose SHA-256 is anchored")
+	notarizeAddress := notarizeCmd.String("address", "", "The address of the account paying the fee")
+	notarizeFee := notarizeCmd.Int("fee", 0, "The amount of tokens paid to the miner who includes the transaction")
+	notarizeMine := notarizeCmd.Bool("mine", false, "Mine immediately on the same node")
+	verifyNotarizationFile := verifyNotarizationCmd.String("file", "", "The file whose SHA-256 is looked for")
+	listAddressesKeys := listaddressescmd.Bool("keys", false, "Print the public key of every address")
 	startNodeMiner := startNodeCmd.String("miner", "", "Enable mining mode and send reward to ADDRESS")
+	startNodeFastSync := startNodeCmd.Bool("fastsync", false, "Skip verifying signatures in blocks up to the last checkpoint")
+	startNodeRPC := startNodeCmd.String("rpc", "", "Serve the mining interface on HOST:PORT")
+	generateBlocks := generateCmd.Int("blocks", 1, "The number of blocks to mine")
+	generateAddress := generateCmd.String("address", "", "The address receiving the generated blocks' rewards")
+	mineRPC := mineCmd.String("rpc", "", "The URL of the node's mining interface, e.g. http://localhost:8332")
+	mineAddress := mineCmd.String("address", "", "The address receiving the mined blocks' rewards")
+	startPoolRPC := startPoolCmd.String("rpc", "", "The URL of the node's mining interface, e.g. http://localhost:8332")
+	startPoolListen := startPoolCmd.String("listen", "localhost:3333", "The HOST:PORT workers connect to")
+	startPoolAddress := startPoolCmd.String("address", "", "The pool's address, receiving whatever isn't paid to workers")
+	startPoolShareBits := startPoolCmd.Int("sharebits", 8, "How many bits easier than the network's target the share target is")
+	startPoolWindow := startPoolCmd.Int("window", 1000, "The number of last shares every block's reward is split between")
+	poolMinePool := poolMineCmd.String("pool", "localhost:3333", "The HOST:PORT of the pool")
+	poolMineAddress := poolMineCmd.String("address", "", "The address receiving this worker's share of the rewards")
+	poolMineWorker := poolMineCmd.String("worker", "", "A name telling this worker apart from others paying to the same address")
+	createMultisigRequired := createMultisigCmd.Int("required", 0, "The number of signatures required to spend")
+	createMultisigKeys := createMultisigCmd.String("keys", "", "Comma separated hex public keys or addresses of the wallet file")
+	createMultisigTxFrom := createMultisigTxCmd.String("from", "", "The multisig address to spend tokens of")
+	createMultisigTxTo := createMultisigTxCmd.String("to", "", "The address of the account you want to send tokens to")
+	createMultisigTxAmount := createMultisigTxCmd.Int("amount", 0, "The amount of tokens you want to send")
+	createMultisigTxFee := createMultisigTxCmd.Int("fee", 0, "The amount of tokens paid to the miner who includes the transaction")
+	createMultisigTxOut := createMultisigTxCmd.String("out", "", "The file the unsigned transaction is written to")
+	signMultisigTxIn := signMultisigTxCmd.String("in", "", "The file of the transaction to sign")
+	signMultisigTxAddress := signMultisigTxCmd.String("address", "", "The address whose key signs, defaults to every key of the wallet file belonging to the multisig")
+	signMultisigTxOut := signMultisigTxCmd.String("out", "", "The file the signed transaction is written to, defaults to the input file")
+	combineMultisigTxIn := combineMultisigTxCmd.String("in", "", "Comma separated files of the same transaction signed by different keys")
+	combineMultisigTxOut := combineMultisigTxCmd.String("out", "", "The file the combined transaction is written to")
+	sendMultisigTxIn := sendMultisigTxCmd.String("in", "", "The file of the signed transaction")
+	sendMultisigTxMiner := sendMultisigTxCmd.String("miner", "", "Mine the transaction on this node, paying the reward to ADDRESS, instead of sending it")
+	supplyHeight := supplyCmd.Int("height", -1, "The height to compute the subsidy and supply at, defaults to the chain's tip")
 
 	switch os.Args[1] {
 	case "getbalance":
@@ -222,6 +953,66 @@ func (cli *CommandLine) Run() {
 	case "startnode":
 		err := startNodeCmd.Parse(os.Args[2:])
 		blockchain.Handle(err)
+	case "supply":
+		err := supplyCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "generate":
+		err := generateCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "deployments":
+		err := deploymentsCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "mine":
+		err := mineCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "startpool":
+		err := startPoolCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "poolmine":
+		err := poolMineCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "vest":
+		err := vestCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "claimvested":
+		err := claimVestedCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "htlc-create":
+		err := htlcCreateCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "htlc-audit":
+		err := htlcAuditCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "htlc-redeem":
+		err := htlcRedeemCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "htlc-refund":
+		err := htlcRefundCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "htlc-secret":
+		err := htlcSecretCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "notarize":
+		err := notarizeCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "verify-notarization":
+		err := verifyNotarizationCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "createmultisig":
+		err := createMultisigCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "createmultisigtx":
+		err := createMultisigTxCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "signmultisigtx":
+		err := signMultisigTxCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "combinemultisigtx":
+		err := combineMultisigTxCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
+	case "sendmultisigtx":
+		err := sendMultisigTxCmd.Parse(os.Args[2:])
+		blockchain.Handle(err)
 	default:
 		cli.printUsage()
 		runtime.Goexit()
@@ -240,15 +1031,87 @@ func (cli *CommandLine) Run() {
 			createBlockChainCmd.Usage()
 			runtime.Goexit()
 		}
-		cli.createBlockChain(*createBlockChainAddress, nodeID)
+		cli.createBlockChain(*createBlockChainAddress, *createBlockChainConsensus, *createBlockChainSigners, nodeID)
 	}
 
 	if sendCmd.Parsed() {
-		if *sendFrom == "" || *sendTo == "" || *sendAmount == 0 {
+		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 || *sendFee < 0 {
 			sendCmd.Usage()
 			runtime.Goexit()
 		}
-		cli.send(*sendFrom, *sendTo, *sendAmount, nodeID, *sendMine)
+		cli.send(*sendFrom, *sendTo, *sendAmount, *sendFee, nodeID, *sendMine, *sendBare)
+	}
+
+	if vestCmd.Parsed() {
+		if *vestFrom == "" || *vestTo == "" || *vestAmount <= 0 || *vestUntil == "" || *vestFee < 0 {
+			vestCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.vest(*vestFrom, *vestTo, *vestAmount, *vestFee, *vestUntil, nodeID, *vestMine)
+	}
+
+	if claimVestedCmd.Parsed() {
+		if *claimVestedAddress == "" || *claimVestedFee < 0 {
+			claimVestedCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.claimVested(*claimVestedAddress, *claimVestedFee, nodeID, *claimVestedMine)
+	}
+
+	if htlcCreateCmd.Parsed() {
+		if *htlcCreateFrom == "" || *htlcCreateTo == "" || *htlcCreateAmount <= 0 || *htlcCreateLockTime == 0 || *htlcCreateFee < 0 || *htlcCreateOut == "" {
+			htlcCreateCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.htlcCreate(*htlcCreateFrom, *htlcCreateTo, *htlcCreateAmount, *htlcCreateFee, *htlcCreateLockTime, *htlcCreateHash, *htlcCreateOut, *htlcCreateNode, nodeID, *htlcCreateMine)
+	}
+
+	if htlcAuditCmd.Parsed() {
+		if *htlcAuditContract == "" {
+			htlcAuditCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.htlcAudit(*htlcAuditContract, nodeID)
+	}
+
+	if htlcRedeemCmd.Parsed() {
+		if *htlcRedeemContract == "" || *htlcRedeemSecret == "" || *htlcRedeemFee < 0 {
+			htlcRedeemCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.htlcRedeem(*htlcRedeemContract, *htlcRedeemSecret, *htlcRedeemAddress, *htlcRedeemFee, *htlcRedeemNode, nodeID, *htlcRedeemMine)
+	}
+
+	if htlcRefundCmd.Parsed() {
+		if *htlcRefundContract == "" || *htlcRefundFee < 0 {
+			htlcRefundCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.htlcRefund(*htlcRefundContract, *htlcRefundAddress, *htlcRefundFee, *htlcRefundNode, nodeID, *htlcRefundMine)
+	}
+
+	if htlcSecretCmd.Parsed() {
+		if *htlcSecretContract == "" {
+			htlcSecretCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.htlcSecret(*htlcSecretContract, nodeID)
+	}
+
+	if notarizeCmd.Parsed() {
+		if *notarizeFile == "" || *notarizeAddress == "" || *notarizeFee < 0 {
+			notarizeCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.notarize(*notarizeFile, *notarizeAddress, *notarizeFee, nodeID, *notarizeMine)
+	}
+
+	if verifyNotarizationCmd.Parsed() {
+		if *verifyNotarizationFile == "" {
+			verifyNotarizationCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.verifyNotarization(*verifyNotarizationFile, nodeID)
 	}
 
 	if printChainCmd.Parsed() {
@@ -260,19 +1123,102 @@ func (cli *CommandLine) Run() {
 	}
 
 	if listaddressescmd.Parsed() {
-		cli.listAddresses(nodeID)
+		cli.listAddresses(nodeID, *listAddressesKeys)
+	}
+
+	if createMultisigCmd.Parsed() {
+		if *createMultisigKeys == "" || *createMultisigRequired <= 0 {
+			createMultisigCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.createMultisig(*createMultisigRequired, *createMultisigKeys, nodeID)
+	}
+
+	if createMultisigTxCmd.Parsed() {
+		if *createMultisigTxFrom == "" || *createMultisigTxTo == "" || *createMultisigTxAmount <= 0 || *createMultisigTxFee < 0 || *createMultisigTxOut == "" {
+			createMultisigTxCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.createMultisigTx(*createMultisigTxFrom, *createMultisigTxTo, *createMultisigTxAmount, *createMultisigTxFee, *createMultisigTxOut, nodeID)
+	}
+
+	if signMultisigTxCmd.Parsed() {
+		if *signMultisigTxIn == "" {
+			signMultisigTxCmd.Usage()
+			runtime.Goexit()
+		}
+		if *signMultisigTxOut == "" {
+			*signMultisigTxOut = *signMultisigTxIn
+		}
+		cli.signMultisigTx(*signMultisigTxIn, *signMultisigTxAddress, *signMultisigTxOut, nodeID)
+	}
+
+	if combineMultisigTxCmd.Parsed() {
+		if *combineMultisigTxIn == "" || *combineMultisigTxOut == "" {
+			combineMultisigTxCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.combineMultisigTx(*combineMultisigTxIn, *combineMultisigTxOut)
+	}
+
+	if sendMultisigTxCmd.Parsed() {
+		if *sendMultisigTxIn == "" {
+			sendMultisigTxCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.sendMultisigTx(*sendMultisigTxIn, *sendMultisigTxMiner, nodeID)
 	}
 
 	if reeindexUTXOcmd.Parsed() {
 		cli.reindexUTXO(nodeID)
 	}
 
+	if supplyCmd.Parsed() {
+		cli.supply(*supplyHeight, nodeID)
+	}
+
+	if deploymentsCmd.Parsed() {
+		cli.deployments(nodeID)
+	}
+
+	if generateCmd.Parsed() {
+		if *generateAddress == "" || *generateBlocks <= 0 {
+			generateCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.generate(*generateBlocks, *generateAddress, nodeID)
+	}
+
+	if mineCmd.Parsed() {
+		if *mineRPC == "" || *mineAddress == "" {
+			mineCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.mine(*mineRPC, *mineAddress)
+	}
+
+	if startPoolCmd.Parsed() {
+		if *startPoolRPC == "" || *startPoolAddress == "" || *startPoolShareBits < 0 || *startPoolWindow <= 0 {
+			startPoolCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.startPool(*startPoolRPC, *startPoolListen, *startPoolAddress, *startPoolShareBits, *startPoolWindow)
+	}
+
+	if poolMineCmd.Parsed() {
+		if *poolMineAddress == "" {
+			poolMineCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.poolMine(*poolMinePool, *poolMineAddress, *poolMineWorker)
+	}
+
 	if startNodeCmd.Parsed() {
 		nodeID := os.Getenv("NODE_ID")
 		if nodeID == "" {
 			startNodeCmd.Usage()
 			runtime.Goexit()
 		}
-		cli.StartNode(nodeID, *startNodeMiner)
+		cli.StartNode(nodeID, *startNodeMiner, *startNodeFastSync, *startNodeRPC)
 	}
 }
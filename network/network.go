@@ -2,15 +2,21 @@ package network
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
 	"encoding/gob"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"golang-blockchain/blockchain"
+	"golang-blockchain/params"
+	"golang-blockchain/wallet"
 	"io"
 	"log"
 	"net"
 	"os"
 	"runtime"
+	"sync"
 	"syscall"
 
 	"slices"
@@ -20,7 +26,7 @@ import (
 
 const (
 	protocol      = "tcp"
-	version       = 1
+	magicLength   = 4 // every message starts with the network's magic bytes
 	commandLength = 12
 )
 
@@ -28,9 +34,14 @@ var (
 	nodeAddress     string
 	minerAddress    string
 	knownAddress    string
-	KnownNodes      = []string{"localhost:3001"}
+	KnownNodes      = slices.Clone(params.Active.SeedNodes)
 	blocksInTransit = [][]byte{}
 	memoryPool      = make(map[string]blockchain.Transaction)
+	memoryPoolMutex sync.Mutex
+
+	// cancels the block currently being mined in the background, if any
+	stopMining  context.CancelFunc
+	miningMutex sync.Mutex
 )
 
 type Address struct {
@@ -138,14 +149,14 @@ func SendInventory(addr, kind string, items [][]byte) {
 func SendTransaction(addr string, tx *blockchain.Transaction) {
 	data := Transaction{AddressFrom: nodeAddress, Transaction: tx.Serialize()}
 	payload := GobEncode(data)
-	request := append(CmdToBytes("inv"), payload...)
+	request := append(CmdToBytes("tx"), payload...)
 
 	SendData(addr, request)
 }
 
 func SendVersion(addr string, chain *blockchain.BlockChain) {
 	bestHeight := chain.GetBestHeight()
-	data := Version{AddressFrom: nodeAddress, Version: version, BestHeight: bestHeight}
+	data := Version{AddressFrom: nodeAddress, Version: params.Active.ProtocolVersion, BestHeight: bestHeight}
 	payload := GobEncode(data)
 	request := append(CmdToBytes("version"), payload...)
 
@@ -168,25 +179,43 @@ func SendGetData(addr, kind string, id []byte) {
 	SendData(addr, request)
 }
 
+// the node relaying transactions between the others, which every node reports to on startup
+func CentralNode() string {
+	return params.Active.SeedNodes[0]
+}
+
+// drop the node from the known nodes, so nothing gets sent to it anymore
+// seed nodes are kept, so a node always has the central node and somewhere to sync from, even if they were down for a while
+func forgetNode(addr string) {
+	if slices.Contains(params.Active.SeedNodes, addr) {
+		return
+	}
+
+	var updatedNodes []string
+
+	for _, node := range KnownNodes {
+		if node != addr {
+			updatedNodes = append(updatedNodes, node)
+		}
+	}
+
+	KnownNodes = updatedNodes
+}
+
 func SendData(addr string, data []byte) {
 	conn, err := net.Dial(protocol, addr)
 	if err != nil {
 		fmt.Printf("%s is not available\n", addr)
-		var updatedNodes []string
-
-		for _, node := range KnownNodes {
-			if node != addr {
-				updatedNodes = append(updatedNodes, node)
-			}
-		}
-
-		KnownNodes = updatedNodes
+		forgetNode(addr)
 
 		return
 	}
 	defer conn.Close()
 
-	_, err = io.Copy(conn, bytes.NewReader(data))
+	// prefix the message with the network's magic, so nodes of other networks ignore it
+	magic := binary.BigEndian.AppendUint32(nil, params.Active.Net)
+
+	_, err = io.Copy(conn, bytes.NewReader(append(magic, data...)))
 	if err != nil {
 		log.Panic(err)
 	}
@@ -220,21 +249,53 @@ func HandleBlock(request []byte, chain *blockchain.BlockChain) {
 	}
 
 	blockData := payload.Block
+	if len(blockData) > chain.Params.MaxBlockSize {
+		fmt.Printf("Rejected a block of %d bytes, more than the limit of %d\n", len(blockData), chain.Params.MaxBlockSize)
+		return
+	}
 	block := blockchain.Deserialize(blockData)
 
 	fmt.Printf("Received a new block!\n")
-	chain.AddBlock(block)
+	tip := chain.LastHash
+	orphan, err := chain.ProcessBlock(block, payload.AddressFrom)
+	if err != nil {
+		fmt.Printf("Rejected block %x: %s\n", block.Hash, err)
+		return
+	}
+
+	// we're missing the block's ancestry, so ask the sender for the oldest block we don't have
+	if orphan {
+		missing := chain.OrphanRoot(block.Hash)
+		fmt.Printf("Block %x is an orphan, requesting %x\n", block.Hash, missing)
+		SendGetData(payload.AddressFrom, "block", missing)
+		return
+	}
 
 	fmt.Printf("Added block %x\n", block.Hash)
 
+	// the block became our new tip, so whatever we were mining is now stale
+	if !bytes.Equal(tip, chain.LastHash) {
+		memoryPoolMutex.Lock()
+		for _, tx := range block.Transactions {
+			delete(memoryPool, hex.EncodeToString(tx.ID))
+		}
+		pending := len(memoryPool)
+		memoryPoolMutex.Unlock()
+
+		if len(minerAddress) > 0 {
+			if pending > 0 {
+				MineTx(chain)
+			} else {
+				StopMining()
+			}
+		}
+	}
+
 	if len(blocksInTransit) > 0 {
 		blockHash := blocksInTransit[0]
 		SendGetData(payload.AddressFrom, "block", blockHash)
 
 		blocksInTransit = blocksInTransit[1:]
-	} else {
-		UTXOSet := blockchain.UTXOSet{Blockchain: chain}
-		UTXOSet.Reindex()
 	}
 }
 
@@ -249,7 +310,9 @@ func HandleGetBlocks(request []byte, chain *blockchain.BlockChain) {
 		log.Panic(err)
 	}
 
+	// announce the blocks oldest first, so every block arrives after its parent
 	blocks := chain.GetBlockHashes()
+	slices.Reverse(blocks)
 	SendInventory(payload.AddressFrom, "block", blocks)
 }
 
@@ -275,7 +338,9 @@ func HandleGetData(request []byte, chain *blockchain.BlockChain) {
 
 	if payload.Type == "tx" {
 		txID := hex.EncodeToString(payload.ID)
+		memoryPoolMutex.Lock()
 		tx := memoryPool[txID]
+		memoryPoolMutex.Unlock()
 
 		SendTransaction(payload.AddressFrom, &tx)
 	}
@@ -293,62 +358,127 @@ func HandleTx(request []byte, chain *blockchain.BlockChain) {
 
 	txData := payload.Transaction
 	tx := blockchain.DeserializeTransaction(txData)
+
+	// only admit transactions that could be mined right away
+	if _, err := chain.ValidateTransaction(&tx); err != nil {
+		fmt.Printf("Rejected transaction %x: %s\n", tx.ID, err)
+		return
+	}
+
+	memoryPoolMutex.Lock()
 	memoryPool[hex.EncodeToString(tx.ID)] = tx
+	pending := len(memoryPool)
+	memoryPoolMutex.Unlock()
 
-	fmt.Printf("%s, %d\n", nodeAddress, len(memoryPool))
+	fmt.Printf("%s, %d\n", nodeAddress, pending)
 
-	if nodeAddress == KnownNodes[0] {
+	if nodeAddress == CentralNode() {
 		for _, node := range KnownNodes {
 			if node != nodeAddress && node != payload.AddressFrom {
 				SendInventory(node, "tx", [][]byte{tx.ID})
 			}
 		}
 	} else {
-		if len(memoryPool) >= 2 && len(minerAddress) > 0 {
+		if pending >= 2 && len(minerAddress) > 0 {
 			MineTx(chain)
 		}
 	}
 }
 
+// start mining a block out of the memory pool in the background
+// a miner that is already running is interrupted, so the new one always works on a fresh template
 func MineTx(chain *blockchain.BlockChain) {
-	var txs []*blockchain.Transaction
+	miningMutex.Lock()
+	defer miningMutex.Unlock()
 
-	for id := range memoryPool {
-		fmt.Printf("tx: %s\n", memoryPool[id].ID)
-		tx := memoryPool[id]
-		if chain.VerifyTransaction(&tx) {
-			txs = append(txs, &tx)
-		}
+	if stopMining != nil {
+		stopMining()
 	}
 
-	if len(txs) == 0 {
+	ctx, cancel := context.WithCancel(context.Background())
+	stopMining = cancel
+
+	go mine(ctx, chain)
+}
+
+// interrupt the block currently being mined, if any
+func StopMining() {
+	miningMutex.Lock()
+	defer miningMutex.Unlock()
+
+	if stopMining != nil {
+		stopMining()
+		stopMining = nil
+	}
+}
+
+func mine(ctx context.Context, chain *blockchain.BlockChain) {
+	template, err := chain.NewBlockTemplate(poolTransactions())
+	blockchain.Handle(err)
+
+	if len(template.Transactions) == 0 {
 		fmt.Println("All Transactions are invalid")
 		return
 	}
 
-	cbTx := blockchain.CoinbaseTx(minerAddress, "")
-	txs = append(txs, cbTx)
+	// the coinbase always comes first, claiming the subsidy along with every picked transaction's fee
+	cbTx := blockchain.CoinbaseTx(minerAddress, "", template.CoinbaseValue)
 
-	newBlock := chain.MineBlock(txs)
-	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
-	UTXOSet.Reindex()
+	fmt.Println("lastheight is", template.Height)
+
+	newBlock, err := chain.SealBlock(ctx, template.NewBlock(cbTx))
+	if errors.Is(err, context.Canceled) {
+		fmt.Println("Mining interrupted")
+		return
+	}
+	if errors.Is(err, blockchain.ErrStaleTip) {
+		// a competing block arrived right as we finished, start over on top of it
+		fmt.Println("Mined a stale block, restarting")
+		MineTx(chain)
+		return
+	}
+	blockchain.Handle(err)
 
 	fmt.Println("New Block mined")
 
-	for _, tx := range txs {
+	if announceBlock(newBlock) > 0 {
+		MineTx(chain)
+	}
+}
+
+// the transactions waiting in the memory pool
+func poolTransactions() []*blockchain.Transaction {
+	memoryPoolMutex.Lock()
+	defer memoryPoolMutex.Unlock()
+
+	var txs []*blockchain.Transaction
+	for id := range memoryPool {
+		fmt.Printf("tx: %s\n", memoryPool[id].ID)
+		tx := memoryPool[id]
+		txs = append(txs, &tx)
+	}
+
+	return txs
+}
+
+// drop a block's transactions from the memory pool and let every known node know about the block
+// returns the number of transactions still waiting in the pool
+func announceBlock(block *blockchain.Block) int {
+	memoryPoolMutex.Lock()
+	for _, tx := range block.Transactions {
 		txID := hex.EncodeToString(tx.ID)
 		delete(memoryPool, txID)
 	}
+	pending := len(memoryPool)
+	memoryPoolMutex.Unlock()
 
 	for _, node := range KnownNodes {
 		if node != nodeAddress {
-			SendInventory(node, "block", [][]byte{newBlock.Hash})
+			SendInventory(node, "block", [][]byte{block.Hash})
 		}
 	}
 
-	if len(memoryPool) > 0 {
-		MineTx(chain)
-	}
+	return pending
 }
 
 func HandleVersion(request []byte, chain *blockchain.BlockChain) {
@@ -362,6 +492,13 @@ func HandleVersion(request []byte, chain *blockchain.BlockChain) {
 		log.Panic(err)
 	}
 
+	// peers speaking another version of the protocol can't be understood, so they're disconnected
+	if payload.Version != params.Active.ProtocolVersion {
+		fmt.Printf("Disconnecting %s, it speaks protocol version %d rather than %d\n", payload.AddressFrom, payload.Version, params.Active.ProtocolVersion)
+		forgetNode(payload.AddressFrom)
+		return
+	}
+
 	bestHeight := chain.GetBestHeight()
 	otherHeight := payload.BestHeight
 
@@ -394,6 +531,13 @@ func HandleInv(request []byte, chain *blockchain.BlockChain) {
 	if payload.Type == "block" {
 		blocksInTransit = payload.Items
 
+		// skipping signatures takes knowing which blocks lead up to the last checkpoint, so its block is fetched first and
+		// its ancestors are walked back to as orphans; every block stays in transit, in case the orphan pool had to drop some
+		if hash, ok := unknownCheckpoint(chain, payload.Items); ok {
+			SendGetData(payload.AddressFrom, "block", hash)
+			return
+		}
+
 		blockHash := payload.Items[0]
 		SendGetData(payload.AddressFrom, "block", blockHash)
 
@@ -409,20 +553,57 @@ func HandleInv(request []byte, chain *blockchain.BlockChain) {
 	if payload.Type == "tx" {
 		txID := payload.Items[0]
 
-		if memoryPool[hex.EncodeToString(txID)].ID == nil {
+		memoryPoolMutex.Lock()
+		known := memoryPool[hex.EncodeToString(txID)].ID != nil
+		memoryPoolMutex.Unlock()
+
+		if !known {
 			SendGetData(payload.AddressFrom, "tx", txID)
 		}
 	}
 }
 
+// the hash of the last checkpoint's block, if the node skips signatures below it, doesn't have it yet and it's among the items
+func unknownCheckpoint(chain *blockchain.BlockChain, items [][]byte) ([]byte, bool) {
+	last := chain.Params.LastCheckpoint()
+	if !chain.SkipCheckpointedSignatures || last == nil {
+		return nil, false
+	}
+
+	for _, item := range items {
+		if hex.EncodeToString(item) != last.Hash {
+			continue
+		}
+
+		_, err := chain.GetBlock(item)
+		return item, err != nil
+	}
+
+	return nil, false
+}
+
 func HandleConnection(conn net.Conn, chain *blockchain.BlockChain) {
-	req, err := io.ReadAll(conn)
+	// no message needs to be much bigger than a full block, so peers can't make us buffer any more than that
+	maxMessageSize := int64(2 * chain.Params.MaxBlockSize)
+
+	req, err := io.ReadAll(io.LimitReader(conn, maxMessageSize+1))
 	defer conn.Close()
 
 	if err != nil {
 		log.Panic(err)
 	}
 
+	if int64(len(req)) > maxMessageSize {
+		fmt.Printf("Ignoring message from %s, it is bigger than %d bytes\n", conn.RemoteAddr(), maxMessageSize)
+		return
+	}
+
+	if len(req) < magicLength+commandLength || binary.BigEndian.Uint32(req) != params.Active.Net {
+		fmt.Printf("Ignoring message from %s, it does not belong to %s\n", conn.RemoteAddr(), params.Active.Name)
+		return
+	}
+	req = req[magicLength:]
+
 	command := BytesToCmd(req[:commandLength])
 	fmt.Printf("Received %s command\n", command)
 
@@ -446,7 +627,8 @@ func HandleConnection(conn net.Conn, chain *blockchain.BlockChain) {
 	}
 }
 
-func StartServer(nodeID, mAddress string) {
+// rpcAddress, if set, is where the mining interface for external miners is served
+func StartServer(nodeID, mAddress string, fastSync bool, rpcAddress string) {
 	nodeAddress = fmt.Sprintf("localhost:%s", nodeID)
 	minerAddress = mAddress
 
@@ -461,8 +643,30 @@ func StartServer(nodeID, mAddress string) {
 	defer chain.Database.Close()
 	go CloseDB(chain)
 
-	if nodeAddress != KnownNodes[0] {
-		SendVersion(KnownNodes[0], chain)
+	chain.SkipCheckpointedSignatures = fastSync
+
+	chain.Hashrate = func(hashesPerSecond float64) {
+		fmt.Printf("Mining at %.2f kH/s\n", hashesPerSecond/1000)
+	}
+
+	// authority engines seal blocks with the miner's own key, which has to be in this node's wallets
+	if authorizer, ok := chain.Engine.(blockchain.Authorizer); ok && len(minerAddress) > 0 {
+		wallets, err := wallet.CreateWallets(nodeID)
+		blockchain.Handle(err)
+
+		w, ok := wallets.Wallets[minerAddress]
+		if !ok {
+			log.Panic("The miner's wallet is needed to seal blocks")
+		}
+		blockchain.Handle(authorizer.Authorize(w))
+	}
+
+	if len(rpcAddress) > 0 {
+		go StartRPCServer(rpcAddress, chain)
+	}
+
+	if nodeAddress != CentralNode() {
+		SendVersion(CentralNode(), chain)
 	}
 
 	for {
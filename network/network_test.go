@@ -0,0 +1,45 @@
+package network
+
+import (
+	"context"
+	"encoding/hex"
+	"golang-blockchain/blockchain"
+	"golang-blockchain/wallet"
+	"testing"
+)
+
+func TestMineClaimsFees(t *testing.T) {
+	w, miner := wallet.MakeWallet(), wallet.MakeWallet()
+	chain, _ := newTestServer(t, string(w.Address()), blockchain.ConsensusConfig{}, nil)
+
+	// let the genesis reward mature, so the wallet has something to pay with
+	if _, err := chain.GenerateBlocks(chain.Params.CoinbaseMaturity, string(wallet.MakeWallet().Address())); err != nil {
+		t.Fatal(err)
+	}
+
+	const fee = 3
+	tx := blockchain.NewTransaction(w, string(wallet.MakeWallet().Address()), 5, fee, &blockchain.UTXOSet{Blockchain: chain})
+
+	pool, address := memoryPool, minerAddress
+	memoryPool = map[string]blockchain.Transaction{hex.EncodeToString(tx.ID): *tx}
+	minerAddress = string(miner.Address())
+	t.Cleanup(func() { memoryPool, minerAddress = pool, address })
+
+	height := chain.GetBestHeight() + 1
+	mine(context.Background(), chain)
+
+	if got := chain.GetBestHeight(); got != height {
+		t.Fatalf("expected block %d to be mined, the chain is at %d", height, got)
+	}
+	if len(memoryPool) != 0 {
+		t.Errorf("the mined transaction is still in the memory pool")
+	}
+
+	balance := 0
+	for _, out := range (&blockchain.UTXOSet{Blockchain: chain}).FindUTXO([]blockchain.Script{blockchain.LockingScript(string(miner.Address()))}) {
+		balance += out.Value
+	}
+	if expected := chain.Params.BlockSubsidy(height) + fee; balance != expected {
+		t.Errorf("expected the miner to be paid the subsidy and the fee, %d, got %d", expected, balance)
+	}
+}
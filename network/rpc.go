@@ -0,0 +1,213 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang-blockchain/blockchain"
+	"log"
+	"net/http"
+	"time"
+)
+
+// how often an external miner checks whether the chain's tip moved on while it's hashing
+const templatePollInterval = 5 * time.Second
+
+// what submitblock answers with
+type SubmitResult struct {
+	Hash     string `json:"hash"`
+	Height   int    `json:"height"`
+	Accepted bool   `json:"accepted"`         // whether the block became the chain's new tip
+	Reason   string `json:"reason,omitempty"` // why the block wasn't accepted
+}
+
+// serve the mining interface over HTTP, so miners running in other processes can do the hashing:
+// GET /getblocktemplate hands out a template built from the memory pool, and
+// POST /submitblock takes the JSON encoded block sealed from it
+func StartRPCServer(address string, chain *blockchain.BlockChain) {
+	fmt.Printf("Serving the mining interface on %s\n", address)
+	log.Panic(http.ListenAndServe(address, rpcHandler(chain)))
+}
+
+// the handler serving the mining interface of the chain
+func rpcHandler(chain *blockchain.BlockChain) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /getblocktemplate", func(w http.ResponseWriter, r *http.Request) {
+		template, err := chain.NewBlockTemplate(poolTransactions())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, template)
+	})
+
+	mux.HandleFunc("POST /submitblock", func(w http.ResponseWriter, r *http.Request) {
+		// the JSON encoding takes more room than the block does, but not without bound
+		r.Body = http.MaxBytesReader(w, r.Body, int64(3*chain.Params.MaxBlockSize))
+
+		var block blockchain.Block
+		if err := json.NewDecoder(r.Body).Decode(&block); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		writeJSON(w, submitBlock(chain, &block))
+	})
+
+	return mux
+}
+
+// add a block sealed by an external miner to the chain, relaying it if it became the new tip
+func submitBlock(chain *blockchain.BlockChain, block *blockchain.Block) SubmitResult {
+	result := SubmitResult{Hash: hex.EncodeToString(block.Hash), Height: block.Height}
+
+	if len(block.Serialize()) > chain.Params.MaxBlockSize {
+		result.Reason = fmt.Sprintf("block is bigger than the limit of %d bytes", chain.Params.MaxBlockSize)
+		return result
+	}
+
+	err := chain.SubmitBlock(block)
+	if err != nil {
+		result.Reason = err.Error()
+		fmt.Printf("Rejected submitted block %x: %s\n", block.Hash, err)
+		return result
+	}
+
+	result.Accepted = true
+	fmt.Printf("Added submitted block %x\n", block.Hash)
+
+	// whatever we were mining ourselves is now stale
+	pending := announceBlock(block)
+	if len(minerAddress) > 0 {
+		if pending > 0 {
+			MineTx(chain)
+		} else {
+			StopMining()
+		}
+	}
+
+	return result
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("could not write response:", err)
+	}
+}
+
+// mine blocks paying their rewards to address, forever, using the mining interface of the node at url
+// hashing starts over on a fresh template whenever the node's tip moves on
+// returns if the node's chain runs an engine whose blocks can't be mined, like proof-of-authority
+func RunMiner(url, address string) {
+	for {
+		template, err := FetchTemplate(url)
+		if err != nil {
+			fmt.Println("Could not get a block template:", err)
+			time.Sleep(templatePollInterval)
+			continue
+		}
+
+		cbTx := blockchain.CoinbaseTx(address, "", template.CoinbaseValue)
+		block := template.NewBlock(cbTx)
+
+		proof, err := template.Proof(block)
+		if err != nil {
+			fmt.Println("Could not mine:", err)
+			return
+		}
+
+		fmt.Printf("Mining block %d on top of %x with %d transactions\n", template.Height, template.PrevHash, len(template.Transactions))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go watchTip(ctx, cancel, url, template.PrevHash)
+
+		err = proof.Run(ctx, func(hashesPerSecond float64) {
+			fmt.Printf("Mining at %.2f kH/s\n", hashesPerSecond/1000)
+		})
+		cancel()
+
+		if errors.Is(err, context.Canceled) {
+			fmt.Println("Chain tip changed, starting over")
+			continue
+		}
+		blockchain.Handle(err)
+
+		result, err := PostBlock(url, block)
+		if err != nil {
+			fmt.Println("Could not submit the block:", err)
+			continue
+		}
+
+		if result.Accepted {
+			fmt.Printf("Block %d accepted: %s\n", result.Height, result.Hash)
+		} else {
+			fmt.Printf("Block %d rejected: %s\n", result.Height, result.Reason)
+		}
+	}
+}
+
+// cancel mining once the node's template is built on top of another block than prevHash
+func watchTip(ctx context.Context, cancel context.CancelFunc, url string, prevHash []byte) {
+	ticker := time.NewTicker(templatePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			template, err := FetchTemplate(url)
+			if err == nil && !bytes.Equal(template.PrevHash, prevHash) {
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// fetch a block template from the mining interface of the node at url
+func FetchTemplate(url string) (*blockchain.BlockTemplate, error) {
+	resp, err := http.Get(url + "/getblocktemplate")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("node answered %s", resp.Status)
+	}
+
+	var template blockchain.BlockTemplate
+	err = json.NewDecoder(resp.Body).Decode(&template)
+
+	return &template, err
+}
+
+// submit a sealed block to the mining interface of the node at url
+func PostBlock(url string, block *blockchain.Block) (*SubmitResult, error) {
+	data, err := json.Marshal(block)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.Post(url+"/submitblock", "application/json", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("node answered %s", resp.Status)
+	}
+
+	var result SubmitResult
+	err = json.NewDecoder(resp.Body).Decode(&result)
+
+	return &result, err
+}
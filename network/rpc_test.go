@@ -0,0 +1,132 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"golang-blockchain/blockchain"
+	"golang-blockchain/params"
+	"golang-blockchain/wallet"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// create a fresh regtest chain running the consensus engine in a temporary directory, served by a mining interface
+// the genesis reward is paid to address, and the signer seals the genesis block of authority chains, and may be nil otherwise
+func newTestServer(t *testing.T, address string, consensus blockchain.ConsensusConfig, signer *wallet.Wallet) (*blockchain.BlockChain, *httptest.Server) {
+	t.Helper()
+
+	active := params.Active
+	params.Active = &params.RegTest
+	t.Cleanup(func() { params.Active = active })
+
+	// accepted blocks are announced to the known nodes, of which there are none here
+	known := KnownNodes
+	KnownNodes = nil
+	t.Cleanup(func() { KnownNodes = known })
+
+	// the database lives under ./tmp, relative to the working directory
+	t.Chdir(t.TempDir())
+	if err := os.Mkdir("tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	chain := blockchain.CreateBlockChain(address, "test", consensus, signer)
+	t.Cleanup(func() { chain.Database.Close() })
+
+	server := httptest.NewServer(rpcHandler(chain))
+	t.Cleanup(server.Close)
+
+	return chain, server
+}
+
+// seal a block from the template, with a coinbase claiming the given value
+func sealTemplate(t *testing.T, template *blockchain.BlockTemplate, value int) *blockchain.Block {
+	t.Helper()
+
+	block := template.NewBlock(blockchain.CoinbaseTx(string(wallet.MakeWallet().Address()), "", value))
+	proof, err := template.Proof(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := proof.Run(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	return block
+}
+
+func TestMiningInterface(t *testing.T) {
+	chain, server := newTestServer(t, string(wallet.MakeWallet().Address()), blockchain.ConsensusConfig{}, nil)
+	tip := chain.LastHash
+
+	template, err := FetchTemplate(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if template.Engine != blockchain.EnginePow || !bytes.Equal(template.PrevHash, tip) || template.Height != 1 {
+		t.Fatalf("expected a %s template for block 1 on top of %x, got a %s one for block %d on top of %x", blockchain.EnginePow, tip, template.Engine, template.Height, template.PrevHash)
+	}
+
+	block := sealTemplate(t, template, template.CoinbaseValue)
+	result, err := PostBlock(server.URL, block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Accepted || result.Height != 1 {
+		t.Fatalf("expected block 1 to be accepted, got block %d rejected: %s", result.Height, result.Reason)
+	}
+	if !bytes.Equal(chain.LastHash, block.Hash) {
+		t.Errorf("expected the submitted block %x to be the tip, got %x", block.Hash, chain.LastHash)
+	}
+
+	// the next template builds on the submitted block
+	if template, err = FetchTemplate(server.URL); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(template.PrevHash, block.Hash) {
+		t.Errorf("expected the template to build on %x, got %x", block.Hash, template.PrevHash)
+	}
+
+	// and a block that doesn't follow the rules is turned down with the reason
+	if result, err = PostBlock(server.URL, sealTemplate(t, template, template.CoinbaseValue+1)); err != nil {
+		t.Fatal(err)
+	}
+	if result.Accepted || result.Reason == "" {
+		t.Errorf("expected a block claiming too much to be rejected with a reason, got %+v", result)
+	}
+	if !bytes.Equal(chain.LastHash, block.Hash) {
+		t.Errorf("expected %x to stay the tip, got %x", block.Hash, chain.LastHash)
+	}
+}
+
+func TestMinerRefusesAuthorityChains(t *testing.T) {
+	signer := wallet.MakeWallet()
+	consensus := blockchain.ConsensusConfig{Engine: blockchain.EnginePoa, Signers: [][]byte{wallet.PublicKeyHash(signer.PublicKey)}}
+	chain, server := newTestServer(t, string(wallet.MakeWallet().Address()), consensus, signer)
+
+	template, err := FetchTemplate(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if template.Engine != blockchain.EnginePoa {
+		t.Fatalf("expected a %s template, got a %s one", blockchain.EnginePoa, template.Engine)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		RunMiner(server.URL, string(wallet.MakeWallet().Address()))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the miner is still running on an authority chain")
+	}
+
+	if height := chain.GetBestHeight(); height != 0 {
+		t.Errorf("expected the chain to stay at the genesis block, got height %d", height)
+	}
+}
@@ -0,0 +1,315 @@
+package params
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// a block known to be part of the chain, which every node has to agree on
+type Checkpoint struct {
+	Height int    `json:"height"`
+	Hash   string `json:"hash"` // hex encoded block hash
+}
+
+// a consensus change miners signal readiness for through a bit of their blocks' version, as in BIP9
+// once enough blocks of a retarget window signal it, it locks in, and becomes active a window later
+type Deployment struct {
+	Name      string `json:"name"`
+	Bit       int    `json:"bit"`       // the version bit signalling the deployment, from 0 to 28
+	StartTime int64  `json:"startTime"` // median time past from which signalling counts, or DeploymentAlwaysActive
+	Timeout   int64  `json:"timeout"`   // median time past by which the deployment fails if it hasn't locked in
+}
+
+// a StartTime making the deployment active from the genesis block on, for testing
+const DeploymentAlwaysActive = -1
+
+// everything that sets one network apart from another: two nodes only accept each other's
+// messages, blocks and addresses when they run with the same parameters
+type ChainParams struct {
+	Name string `json:"name"`
+
+	// network
+	Net             uint32   `json:"net"`             // magic bytes prefixed to every message sent to peers
+	ProtocolVersion int      `json:"protocolVersion"` // version announced to peers
+	SeedNodes       []string `json:"seedNodes"`       // the nodes contacted first, the first one being the central node
+
+	// addresses
+	AddressVersion       byte `json:"addressVersion"`       // version byte prefixed to every address
+	ScriptAddressVersion byte `json:"scriptAddressVersion"` // version byte prefixed to the addresses of scripts, such as multisig ones
+
+	// genesis
+	GenesisData string `json:"genesisData"` // data stored in the genesis block's coinbase
+
+	// proof-of-work
+	Difficulty       int   `json:"difficulty"`       // number of leading zero bits of the easiest target allowed
+	ScryptDifficulty int   `json:"scryptDifficulty"` // the same, for chains running scrypt proof-of-work
+	RetargetInterval int   `json:"retargetInterval"` // number of blocks between two difficulty adjustments
+	TargetSpacing    int64 `json:"targetSpacing"`    // desired number of seconds between two blocks
+	NoRetargeting    bool  `json:"noRetargeting"`    // keep every block at the easiest target instead of retargeting
+	AllowGenerate    bool  `json:"allowGenerate"`    // allow mining blocks on demand, for testing
+
+	// limits
+	MaxBlockSize int `json:"maxBlockSize"` // the most bytes a serialized block may take
+	MaxTxSize    int `json:"maxTxSize"`    // the most bytes a serialized transaction may take
+	MaxTxInputs  int `json:"maxTxInputs"`  // the most inputs a transaction may have
+
+	MaxDataCarrierSize int `json:"maxDataCarrierSize"` // the most bytes a data output may carry, zero disabling them
+
+	// soft forks, and the number of blocks of a retarget window that must signal one for it to lock in
+	Deployments         []Deployment `json:"deployments,omitempty"`
+	ActivationThreshold int          `json:"activationThreshold"`
+
+	// blocks every node has to agree on, ordered by height
+	// as every chain's genesis block is unique, only custom profiles can list any
+	Checkpoints []Checkpoint `json:"checkpoints,omitempty"`
+
+	// subsidy
+	InitialReward    int `json:"initialReward"`    // tokens minted by each block before the first halving
+	HalvingInterval  int `json:"halvingInterval"`  // number of blocks between two halvings
+	MaxSupply        int `json:"maxSupply"`        // the most tokens that will ever be issued
+	CoinbaseMaturity int `json:"coinbaseMaturity"` // blocks that must be built on top of a coinbase before it can be spent
+}
+
+var MainNet = ChainParams{
+	Name: "mainnet",
+
+	Net:             0xd9b4bef9,
+	ProtocolVersion: 1,
+	SeedNodes:       []string{"localhost:3001"},
+
+	AddressVersion:       0x00,
+	ScriptAddressVersion: 0x05,
+
+	GenesisData: "First Transaction from genesis",
+
+	Difficulty:       20,
+	ScryptDifficulty: 12,
+	RetargetInterval: 10,
+	TargetSpacing:    10,
+
+	MaxBlockSize: 1000000,
+	MaxTxSize:    100000,
+	MaxTxInputs:  400,
+
+	MaxDataCarrierSize: 80,
+
+	ActivationThreshold: 9,
+
+	InitialReward:    20,
+	HalvingInterval:  10000,
+	MaxSupply:        380000,
+	CoinbaseMaturity: 100,
+}
+
+var TestNet = ChainParams{
+	Name: "testnet",
+
+	Net:             0x0709110b,
+	ProtocolVersion: 1,
+	SeedNodes:       []string{"localhost:13001"},
+
+	AddressVersion:       0x6f,
+	ScriptAddressVersion: 0xc4,
+
+	GenesisData: "First Transaction from testnet genesis",
+
+	Difficulty:       16,
+	ScryptDifficulty: 8,
+	RetargetInterval: 10,
+	TargetSpacing:    10,
+
+	MaxBlockSize: 1000000,
+	MaxTxSize:    100000,
+	MaxTxInputs:  400,
+
+	MaxDataCarrierSize: 80,
+
+	ActivationThreshold: 9,
+
+	InitialReward:    20,
+	HalvingInterval:  10000,
+	MaxSupply:        380000,
+	CoinbaseMaturity: 100,
+}
+
+var RegTest = ChainParams{
+	Name: "regtest",
+
+	Net:             0xdab5bffa,
+	ProtocolVersion: 1,
+	SeedNodes:       []string{"localhost:23001"},
+
+	AddressVersion:       0x8c,
+	ScriptAddressVersion: 0x26,
+
+	GenesisData: "First Transaction from regtest genesis",
+
+	Difficulty:       1,
+	ScryptDifficulty: 1,
+	RetargetInterval: 10,
+	TargetSpacing:    10,
+	NoRetargeting:    true,
+	AllowGenerate:    true,
+
+	MaxBlockSize: 1000000,
+	MaxTxSize:    100000,
+	MaxTxInputs:  400,
+
+	MaxDataCarrierSize: 80,
+
+	Deployments: []Deployment{
+		{Name: "testdummy", Bit: 28, StartTime: 0, Timeout: math.MaxInt64},
+	},
+	ActivationThreshold: 8,
+
+	InitialReward:    20,
+	HalvingInterval:  150,
+	MaxSupply:        5700,
+	CoinbaseMaturity: 100,
+}
+
+// the parameters the node is running with, mainnet unless another profile is selected
+var Active = &MainNet
+
+// select the parameters the node runs with, either one of the predefined
+// profiles by name or a custom profile from a JSON file
+func Select(profile string) error {
+	p, err := Lookup(profile)
+	if err != nil {
+		return err
+	}
+
+	Active = p
+
+	return nil
+}
+
+// find a predefined profile by name, or load a custom one if the name is a path to a JSON file
+func Lookup(profile string) (*ChainParams, error) {
+	switch profile {
+	case "", MainNet.Name:
+		return &MainNet, nil
+	case TestNet.Name:
+		return &TestNet, nil
+	case RegTest.Name:
+		return &RegTest, nil
+	}
+
+	if strings.HasSuffix(profile, ".json") {
+		return Load(profile)
+	}
+
+	return nil, fmt.Errorf("unknown network %q", profile)
+}
+
+// load a custom profile from a JSON file
+// fields the file leaves out keep their mainnet values
+func Load(path string) (*ChainParams, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := MainNet
+	p.Name = ""
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return &p, nil
+}
+
+func (p *ChainParams) validate() error {
+	switch {
+	case p.Name == "":
+		return errors.New("the network needs a name")
+	case p.Difficulty < 1 || p.Difficulty > 255:
+		return errors.New("difficulty must be between 1 and 255")
+	case p.ScryptDifficulty < 1 || p.ScryptDifficulty > 255:
+		return errors.New("scrypt difficulty must be between 1 and 255")
+	case p.RetargetInterval < 1:
+		return errors.New("retarget interval must be at least 1")
+	case p.TargetSpacing < 1:
+		return errors.New("target spacing must be at least 1")
+	case p.HalvingInterval < 1:
+		return errors.New("halving interval must be at least 1")
+	case p.InitialReward < 0 || p.MaxSupply < 0:
+		return errors.New("initial reward and maximum supply can't be negative")
+	case p.CoinbaseMaturity < 0:
+		return errors.New("coinbase maturity can't be negative")
+	case p.MaxBlockSize < 1 || p.MaxTxSize < 1 || p.MaxTxInputs < 1:
+		return errors.New("block and transaction limits must be at least 1")
+	case p.MaxDataCarrierSize < 0:
+		return errors.New("data carrier size can't be negative")
+	case p.MaxTxSize > p.MaxBlockSize:
+		return errors.New("transactions can't be allowed to be bigger than blocks")
+	case p.ActivationThreshold < 1 || p.ActivationThreshold > p.RetargetInterval:
+		return errors.New("activation threshold must be between 1 and the retarget interval")
+	case len(p.SeedNodes) == 0:
+		return errors.New("at least one seed node is needed")
+	case p.AddressVersion == p.ScriptAddressVersion:
+		return errors.New("addresses of keys and scripts need different version bytes")
+	}
+
+	bits := make(map[int]bool)
+	for _, deployment := range p.Deployments {
+		if deployment.Bit < 0 || deployment.Bit > 28 || bits[deployment.Bit] {
+			return fmt.Errorf("deployment %s needs a bit of its own, between 0 and 28", deployment.Name)
+		}
+		bits[deployment.Bit] = true
+	}
+
+	for i, checkpoint := range p.Checkpoints {
+		if hash, err := hex.DecodeString(checkpoint.Hash); err != nil || len(hash) != 32 {
+			return fmt.Errorf("checkpoint at height %d has an invalid hash", checkpoint.Height)
+		}
+
+		if i > 0 && checkpoint.Height <= p.Checkpoints[i-1].Height {
+			return errors.New("checkpoints must be ordered by height")
+		}
+
+		p.Checkpoints[i].Hash = strings.ToLower(checkpoint.Hash)
+	}
+
+	return nil
+}
+
+// the hash of the checkpointed block at the given height, if there is one
+func (p *ChainParams) CheckpointAt(height int) (string, bool) {
+	for _, checkpoint := range p.Checkpoints {
+		if checkpoint.Height == height {
+			return checkpoint.Hash, true
+		}
+	}
+
+	return "", false
+}
+
+// the deployment with the given name, if there is one
+func (p *ChainParams) Deployment(name string) (*Deployment, bool) {
+	for i := range p.Deployments {
+		if p.Deployments[i].Name == name {
+			return &p.Deployments[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// the highest checkpoint, or nil if there are none
+func (p *ChainParams) LastCheckpoint() *Checkpoint {
+	if len(p.Checkpoints) == 0 {
+		return nil
+	}
+
+	return &p.Checkpoints[len(p.Checkpoints)-1]
+}
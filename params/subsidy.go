@@ -0,0 +1,32 @@
+package params
+
+// the reward paid to miners starts at InitialReward and halves every HalvingInterval blocks,
+// and no block may pay out tokens that would push the total supply past MaxSupply
+
+// the amount of tokens the block at the given height may mint
+func (p *ChainParams) BlockSubsidy(height int) int {
+	return p.TotalSupply(height) - p.TotalSupply(height-1)
+}
+
+// the amount of tokens issued by the blocks up to and including the given height
+func (p *ChainParams) TotalSupply(height int) int {
+	if height < 0 {
+		return 0
+	}
+
+	total := 0
+	blocks := height + 1
+
+	// add up whole halving eras, until the reward runs out or the height is reached
+	for reward := p.InitialReward; reward > 0 && blocks > 0; reward >>= 1 {
+		eraBlocks := min(blocks, p.HalvingInterval)
+		total += eraBlocks * reward
+		blocks -= eraBlocks
+
+		if total >= p.MaxSupply {
+			return p.MaxSupply
+		}
+	}
+
+	return total
+}
@@ -0,0 +1,34 @@
+package params
+
+import (
+	"math/bits"
+	"testing"
+)
+
+func TestSubsidyWithinMaxSupply(t *testing.T) {
+	for _, p := range []ChainParams{MainNet, RegTest} {
+		t.Run(p.Name, func(t *testing.T) {
+			// the reward halves to zero after as many halvings as it has bits, one more era is past all of them
+			lastHeight := (bits.Len(uint(p.InitialReward))+1)*p.HalvingInterval - 1
+
+			total := 0
+			for height := 0; height <= lastHeight; height++ {
+				subsidy := p.BlockSubsidy(height)
+				if subsidy < 0 || subsidy > p.InitialReward {
+					t.Fatalf("block %d mints %d tokens", height, subsidy)
+				}
+				total += subsidy
+			}
+
+			if total > p.MaxSupply {
+				t.Errorf("blocks mint %d tokens over all halvings, more than the max supply of %d", total, p.MaxSupply)
+			}
+			if supply := p.TotalSupply(lastHeight); supply != total {
+				t.Errorf("total supply is %d, the subsidies add up to %d", supply, total)
+			}
+			if subsidy := p.BlockSubsidy(lastHeight + 1); subsidy != 0 {
+				t.Errorf("block %d, past every halving, mints %d tokens", lastHeight+1, subsidy)
+			}
+		})
+	}
+}
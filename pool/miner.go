@@ -0,0 +1,129 @@
+package pool
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang-blockchain/blockchain"
+	"math/big"
+	"net"
+	"sync"
+)
+
+// mine for the pool at poolAddress, with address receiving this worker's share of the rewards
+// whenever the pool hands out a new job, the current one is dropped; returns once the connection is lost
+func RunWorker(poolAddress, address, name string) error {
+	conn, err := net.Dial("tcp", poolAddress)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var mutex sync.Mutex
+	encoder := json.NewEncoder(conn)
+
+	send := func(method string, params any) error {
+		msg, err := encodeMessage(method, params)
+		if err != nil {
+			return err
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		return encoder.Encode(msg)
+	}
+
+	if err := send(methodLogin, Login{address, name}); err != nil {
+		return err
+	}
+
+	// cancels mining the current job
+	stop := func() {}
+	defer func() { stop() }()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 4096), maxMessageLength)
+
+	for scanner.Scan() {
+		var msg Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			return err
+		}
+
+		switch msg.Method {
+		case methodJob:
+			var job Job
+			if err := json.Unmarshal(msg.Params, &job); err != nil {
+				return err
+			}
+
+			fmt.Printf("New job %s for block %d\n", job.ID, job.Header.Height)
+
+			stop()
+			ctx, cancel := context.WithCancel(context.Background())
+			stop = cancel
+			go mineJob(ctx, job, func(share Share) error {
+				return send(methodSubmit, share)
+			})
+		case methodResult:
+			var result ShareResult
+			if err := json.Unmarshal(msg.Params, &result); err != nil {
+				return err
+			}
+
+			switch {
+			case result.Block:
+				fmt.Printf("Share %s:%d found a block!\n", result.JobID, result.Nonce)
+			case result.Accepted:
+				fmt.Printf("Share %s:%d accepted\n", result.JobID, result.Nonce)
+			default:
+				fmt.Printf("Share %s:%d rejected: %s\n", result.JobID, result.Nonce, result.Reason)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return errors.New("the pool closed the connection")
+}
+
+// search the job's header for shares until ctx is cancelled, submitting every one found
+func mineJob(ctx context.Context, job Job, submit func(Share) error) {
+	hash, err := blockchain.EngineHash(job.Engine)
+	if err != nil {
+		fmt.Println("Can't mine job:", err)
+		return
+	}
+
+	shareTarget, ok := new(big.Int).SetString(job.ShareTarget, 16)
+	if !ok {
+		fmt.Println("Can't mine job: invalid share target")
+		return
+	}
+
+	block := &blockchain.Block{BlockHeader: job.Header}
+	proof := blockchain.NewProofWithHash(block, hash)
+	proof.Target = shareTarget
+
+	for {
+		err := proof.Run(ctx, func(hashesPerSecond float64) {
+			fmt.Printf("Mining at %.2f kH/s\n", hashesPerSecond/1000)
+		})
+		if err != nil {
+			return
+		}
+
+		if err := submit(Share{job.ID, block.Nonce, block.Timestamp}); err != nil {
+			fmt.Println("Could not submit share:", err)
+			return
+		}
+
+		// carry on after the share just found
+		block.Nonce++
+	}
+}
@@ -0,0 +1,408 @@
+package pool
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang-blockchain/blockchain"
+	"golang-blockchain/network"
+	"golang-blockchain/wallet"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	templatePollInterval = 5 * time.Second  // how often the node is asked whether its tip moved on
+	jobRefreshInterval   = 30 * time.Second // how often workers get fresh jobs anyway, so payouts follow the latest shares
+	maxMessageLength     = 64 * 1024        // no message a worker sends needs to be any longer
+	writeTimeout         = 10 * time.Second // how long a worker gets to take a message before it's dropped
+)
+
+// the most a share target can be, so a hash of any value meets it
+var maxTarget = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+
+// a mining pool, handing out work for the node at RPC to the workers connected to it
+// workers are credited with a share whenever they find a header meeting the share target, which is easier than
+// the network's, and every block found pays the last Window shares' addresses through its coinbase
+type Server struct {
+	RPC       string // URL of the node's mining interface
+	Address   string // the pool's own address, which gets whatever isn't paid to workers
+	ShareBits int    // how many bits easier than the network's target the share target is
+	Window    int    // the number of shares every block's reward is split between
+
+	mutex      sync.Mutex
+	template   *blockchain.BlockTemplate
+	issued     time.Time       // when the current jobs were handed out
+	generation int             // incremented whenever new jobs are handed out
+	jobs       map[string]*job // the jobs still accepting shares, by ID
+	lastJob    uint64
+	workers    map[*worker]bool
+	stats      map[string]*WorkerStats // by worker name
+	window     shareWindow
+}
+
+// what a worker has submitted so far
+type WorkerStats struct {
+	Accepted int
+	Rejected int
+	Blocks   int
+}
+
+type job struct {
+	Job
+	generation  int
+	worker      *worker
+	block       *blockchain.Block
+	hash        blockchain.PowHash
+	target      *big.Int
+	shareTarget *big.Int
+	work        *big.Int        // how much a share of this job is worth
+	seen        map[string]bool // the shares already submitted, so none counts twice
+}
+
+type worker struct {
+	conn    net.Conn
+	login   Login
+	name    string
+	encoder *json.Encoder
+	mutex   sync.Mutex // serializes the messages sent to the worker
+}
+
+func NewServer(rpcURL, address string, shareBits, window int) *Server {
+	return &Server{
+		RPC:       rpcURL,
+		Address:   address,
+		ShareBits: shareBits,
+		Window:    window,
+		jobs:      make(map[string]*job),
+		workers:   make(map[*worker]bool),
+		stats:     make(map[string]*WorkerStats),
+		window:    shareWindow{size: window},
+	}
+}
+
+// accept workers on the given address and keep them busy, until listening fails
+func (s *Server) ListenAndServe(address string) error {
+	if err := s.update(); err != nil {
+		return err
+	}
+
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+
+	fmt.Printf("Pool listening on %s, mining for %s\n", address, s.RPC)
+
+	go s.pollTemplates()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handleConnection(conn)
+	}
+}
+
+func (s *Server) pollTemplates() {
+	for {
+		time.Sleep(templatePollInterval)
+
+		if err := s.update(); err != nil {
+			fmt.Println("Could not get a block template:", err)
+		}
+	}
+}
+
+// fetch the node's template and hand out new jobs if the tip moved on, or the current jobs got old
+func (s *Server) update() error {
+	template, err := network.FetchTemplate(s.RPC)
+	if err != nil {
+		return err
+	}
+
+	if _, err := blockchain.EngineHash(template.Engine); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tipMoved := s.template == nil || !bytes.Equal(s.template.PrevHash, template.PrevHash)
+	if !tipMoved && time.Since(s.issued) < jobRefreshInterval {
+		return nil
+	}
+
+	s.template = template
+	s.issued = time.Now()
+	s.generation++
+
+	for id, j := range s.jobs {
+		// jobs built on the old tip can't make blocks anymore, and the ones before the last refresh are let go too
+		if tipMoved || j.generation < s.generation-1 {
+			delete(s.jobs, id)
+		}
+	}
+
+	if tipMoved {
+		fmt.Printf("New work on top of %x at height %d\n", template.PrevHash, template.Height)
+	}
+
+	for w := range s.workers {
+		s.sendJob(w)
+	}
+
+	return nil
+}
+
+// build a job for the worker out of the current template, with a coinbase paying the share window
+// s.mutex has to be held
+func (s *Server) sendJob(w *worker) {
+	s.lastJob++
+
+	coinbase := blockchain.PayoutCoinbaseTx(s.window.payouts(s.template.CoinbaseValue, s.Address), "")
+	block := s.template.NewBlock(coinbase)
+	hash, _ := blockchain.EngineHash(s.template.Engine)
+
+	target := blockchain.CompactToBig(block.Bits)
+	shareTarget := new(big.Int).Lsh(target, uint(s.ShareBits))
+	if shareTarget.Cmp(maxTarget) > 0 {
+		shareTarget.Set(maxTarget)
+	}
+
+	// shares are weighted by their target's work, which only the compact form has a measure of
+	shareBits := blockchain.BigToCompact(shareTarget)
+	shareTarget = blockchain.CompactToBig(shareBits)
+
+	j := &job{
+		Job: Job{
+			ID:          fmt.Sprintf("%x", s.lastJob),
+			Engine:      s.template.Engine,
+			Header:      block.BlockHeader,
+			ShareTarget: fmt.Sprintf("%064x", shareTarget),
+		},
+		generation:  s.generation,
+		worker:      w,
+		block:       block,
+		hash:        hash,
+		target:      target,
+		shareTarget: shareTarget,
+		work:        blockchain.CalcWork(shareBits),
+		seen:        make(map[string]bool),
+	}
+	s.jobs[j.ID] = j
+
+	if err := w.send(methodJob, j.Job); err != nil {
+		fmt.Printf("Could not send a job to %s: %s\n", w.name, err)
+	}
+}
+
+func (s *Server) handleConnection(conn net.Conn) {
+	w := &worker{conn: conn, encoder: json.NewEncoder(conn)}
+	defer s.disconnect(w)
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 4096), maxMessageLength)
+
+	for scanner.Scan() {
+		var msg Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			fmt.Printf("Dropping %s: %s\n", conn.RemoteAddr(), err)
+			return
+		}
+
+		switch msg.Method {
+		case methodLogin:
+			if err := s.login(w, msg.Params); err != nil {
+				fmt.Printf("Dropping %s: %s\n", conn.RemoteAddr(), err)
+				return
+			}
+		case methodSubmit:
+			var sh Share
+			if err := json.Unmarshal(msg.Params, &sh); err != nil || w.name == "" {
+				fmt.Printf("Dropping %s: bad share\n", conn.RemoteAddr())
+				return
+			}
+
+			if err := w.send(methodResult, s.submit(w, sh)); err != nil {
+				fmt.Printf("Could not send a result to %s: %s\n", w.name, err)
+			}
+		default:
+			fmt.Printf("Unknown method %q from %s\n", msg.Method, conn.RemoteAddr())
+		}
+	}
+}
+
+func (s *Server) login(w *worker, params json.RawMessage) error {
+	var login Login
+	if err := json.Unmarshal(params, &login); err != nil {
+		return err
+	}
+
+	if !wallet.ValidateAddress(login.Address) {
+		return errors.New("invalid payout address")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if w.name != "" {
+		return errors.New("logged in twice")
+	}
+
+	// workers are told apart by their payout address and their name, as in address.worker
+	w.login = login
+	w.name = login.Address
+	if login.Worker != "" {
+		w.name += "." + login.Worker
+	}
+
+	if s.stats[w.name] == nil {
+		s.stats[w.name] = &WorkerStats{}
+	}
+	s.workers[w] = true
+
+	fmt.Printf("Worker %s connected from %s\n", w.name, w.conn.RemoteAddr())
+	s.sendJob(w)
+
+	return nil
+}
+
+func (s *Server) disconnect(w *worker) {
+	w.conn.Close()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.workers[w] {
+		return
+	}
+	delete(s.workers, w)
+
+	for id, j := range s.jobs {
+		if j.worker == w {
+			delete(s.jobs, id)
+		}
+	}
+
+	stats := s.stats[w.name]
+	fmt.Printf("Worker %s disconnected: %d shares accepted, %d rejected, %d blocks\n", w.name, stats.Accepted, stats.Rejected, stats.Blocks)
+}
+
+// check a share against its job, credit the worker for it, and submit it to the node if it's a block too
+func (s *Server) submit(w *worker, sh Share) ShareResult {
+	result := ShareResult{JobID: sh.JobID, Nonce: sh.Nonce}
+
+	s.mutex.Lock()
+	stats := s.stats[w.name]
+	j, ok := s.jobs[sh.JobID]
+	s.mutex.Unlock()
+
+	if !ok || j.worker != w {
+		return s.reject(stats, result, "unknown or stale job")
+	}
+
+	// hashing is the slow part, scrypt's especially, so other workers' shares aren't held up by it
+	header, hash, err := j.check(sh)
+	if err != nil {
+		return s.reject(stats, result, err.Error())
+	}
+
+	s.mutex.Lock()
+	// the same share may have been submitted again while it was being checked, only the first one counts
+	key := sh.key()
+	if j.seen[key] {
+		s.mutex.Unlock()
+		return s.reject(stats, result, "duplicate share")
+	}
+	j.seen[key] = true
+
+	stats.Accepted++
+	s.window.add(share{w.login.Address, j.work})
+	s.mutex.Unlock()
+
+	result.Accepted = true
+	if hash.Cmp(j.target) >= 0 {
+		return result
+	}
+
+	block := *j.block
+	block.BlockHeader = header
+	block.Hash = header.Hash()
+
+	submitted, err := network.PostBlock(s.RPC, &block)
+	if err != nil {
+		fmt.Printf("Could not submit block %x: %s\n", block.Hash, err)
+		return result
+	}
+	if !submitted.Accepted {
+		fmt.Printf("Block %x found by %s was rejected: %s\n", block.Hash, w.name, submitted.Reason)
+		return result
+	}
+
+	fmt.Printf("Block %d found by %s: %x\n", block.Height, w.name, block.Hash)
+	result.Block = true
+
+	s.mutex.Lock()
+	stats.Blocks++
+	s.mutex.Unlock()
+
+	if err := s.update(); err != nil {
+		fmt.Println("Could not get a block template:", err)
+	}
+
+	return result
+}
+
+// count the share against the worker, giving the reason why
+func (s *Server) reject(stats *WorkerStats, result ShareResult, reason string) ShareResult {
+	s.mutex.Lock()
+	stats.Rejected++
+	s.mutex.Unlock()
+
+	result.Reason = reason
+	return result
+}
+
+// what tells shares of the same job apart
+func (sh Share) key() string {
+	return fmt.Sprintf("%d:%d", sh.Nonce, sh.Timestamp)
+}
+
+// the job's header with the share's nonce and timestamp, and its hash, if it meets the share target
+// the job's fields used here never change, so s.mutex doesn't have to be held
+func (j *job) check(sh Share) (blockchain.BlockHeader, *big.Int, error) {
+	if sh.Timestamp < j.Header.Timestamp || sh.Timestamp > time.Now().Add(blockchain.MaxFutureBlockTime).Unix() {
+		return blockchain.BlockHeader{}, nil, errors.New("timestamp out of range")
+	}
+
+	header := j.Header
+	header.Nonce = sh.Nonce
+	header.Timestamp = sh.Timestamp
+
+	hash := new(big.Int).SetBytes(j.hash.Sum(header.Serialize()))
+	if hash.Cmp(j.shareTarget) >= 0 {
+		return blockchain.BlockHeader{}, nil, errors.New("share doesn't meet the share target")
+	}
+
+	return header, hash, nil
+}
+
+func (w *worker) send(method string, params any) error {
+	msg, err := encodeMessage(method, params)
+	if err != nil {
+		return err
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return w.encoder.Encode(msg)
+}
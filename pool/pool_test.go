@@ -0,0 +1,137 @@
+package pool
+
+import (
+	"encoding/json"
+	"golang-blockchain/blockchain"
+	"golang-blockchain/wallet"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// a pool working on a template no share can make a block of, so nothing gets submitted to a node
+func newTestPool(t *testing.T) *Server {
+	t.Helper()
+
+	s := NewServer("", string(wallet.MakeWallet().Address()), 250, 10)
+	s.template = &blockchain.BlockTemplate{
+		Engine:        blockchain.EnginePow,
+		PrevHash:      make([]byte, 32),
+		Height:        1,
+		Bits:          0x03000001,
+		Timestamp:     time.Now().Unix(),
+		CoinbaseValue: 20,
+	}
+
+	return s
+}
+
+// a worker logged in to the pool, whose messages are thrown away
+func newTestWorker(t *testing.T, s *Server) *worker {
+	t.Helper()
+
+	conn, other := net.Pipe()
+	t.Cleanup(func() { conn.Close(); other.Close() })
+	go io.Copy(io.Discard, other)
+
+	login, err := json.Marshal(Login{Address: string(wallet.MakeWallet().Address())})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := &worker{conn: conn, encoder: json.NewEncoder(conn)}
+	if err := s.login(w, login); err != nil {
+		t.Fatal(err)
+	}
+
+	return w
+}
+
+// the job the pool handed the worker
+func jobOf(t *testing.T, s *Server, w *worker) *job {
+	t.Helper()
+
+	for _, j := range s.jobs {
+		if j.worker == w {
+			return j
+		}
+	}
+
+	t.Fatal("the worker has no job")
+	return nil
+}
+
+// the first share of the job, from the given nonce on, whose hash does or doesn't meet the share target
+func findShare(j *job, nonce uint64, meets bool) Share {
+	header := j.Header
+	for header.Nonce = nonce; ; header.Nonce++ {
+		hash := new(big.Int).SetBytes(blockchain.SHA256Hash.Sum(header.Serialize()))
+		if (hash.Cmp(j.shareTarget) < 0) == meets {
+			return Share{JobID: j.ID, Nonce: header.Nonce, Timestamp: header.Timestamp}
+		}
+	}
+}
+
+func TestSubmitShare(t *testing.T) {
+	s := newTestPool(t)
+	w, other := newTestWorker(t, s), newTestWorker(t, s)
+	j := jobOf(t, s, w)
+	valid := findShare(j, 0, true)
+
+	tests := []struct {
+		name   string
+		worker *worker
+		share  Share
+		reason string // empty if the share is accepted
+	}{
+		{"meeting the share target", w, valid, ""},
+		{"submitted twice", w, valid, "duplicate share"},
+		{"missing the share target", w, findShare(j, 0, false), "share doesn't meet the share target"},
+		{"of another worker's job", other, findShare(j, valid.Nonce+1, true), "unknown or stale job"},
+		{"of an unknown job", w, Share{JobID: "unknown"}, "unknown or stale job"},
+		{"timestamped before the job", w, Share{JobID: j.ID, Timestamp: j.Header.Timestamp - 1}, "timestamp out of range"},
+		{"timestamped too far in the future", w, Share{JobID: j.ID, Timestamp: time.Now().Add(blockchain.MaxFutureBlockTime + time.Minute).Unix()}, "timestamp out of range"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := s.submit(test.worker, test.share)
+			if result.Accepted != (test.reason == "") || result.Reason != test.reason || result.Block {
+				t.Fatalf("expected the share to be accepted %t with reason %q, got %+v", test.reason == "", test.reason, result)
+			}
+		})
+	}
+
+	// only the one valid share was credited, at the work of the job's share target
+	if stats := s.stats[w.name]; stats.Accepted != 1 || stats.Rejected != len(tests)-2 {
+		t.Errorf("expected 1 share accepted and %d rejected, got %+v", len(tests)-2, stats)
+	}
+	if len(s.window.shares) != 1 || s.window.shares[0].address != w.login.Address || s.window.shares[0].work.Cmp(j.work) != 0 {
+		t.Errorf("expected the window to hold the worker's share, got %v", s.window.shares)
+	}
+}
+
+func TestSubmitShareConcurrently(t *testing.T) {
+	s := newTestPool(t)
+	w := newTestWorker(t, s)
+	sh := findShare(jobOf(t, s, w), 0, true)
+
+	// the share is hashed without holding the pool's lock, but only one of its copies may count
+	results := make(chan ShareResult)
+	for range 8 {
+		go func() { results <- s.submit(w, sh) }()
+	}
+
+	accepted := 0
+	for range 8 {
+		if result := <-results; result.Accepted {
+			accepted++
+		}
+	}
+
+	if accepted != 1 || len(s.window.shares) != 1 {
+		t.Errorf("expected one copy of the share to be credited, %d were accepted and %d credited", accepted, len(s.window.shares))
+	}
+}
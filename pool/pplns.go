@@ -0,0 +1,62 @@
+package pool
+
+import (
+	"golang-blockchain/blockchain"
+	"math/big"
+)
+
+// a share counted towards the pool's payouts, weighted by the work its target stands for
+type share struct {
+	address string
+	work    *big.Int
+}
+
+// the last shares submitted to the pool, out of which blocks pay their miners (pay per last N shares)
+type shareWindow struct {
+	size   int
+	shares []share
+}
+
+func (window *shareWindow) add(s share) {
+	window.shares = append(window.shares, s)
+
+	if len(window.shares) > window.size {
+		window.shares = window.shares[len(window.shares)-window.size:]
+	}
+}
+
+// split value between the addresses in the window, in proportion to the work of their shares
+// the remainder of the division, or everything if there are no shares yet, goes to the pool's own address
+func (window *shareWindow) payouts(value int, poolAddress string) []blockchain.Payout {
+	var addresses []string
+	work := make(map[string]*big.Int)
+	total := new(big.Int)
+
+	for _, s := range window.shares {
+		if work[s.address] == nil {
+			addresses = append(addresses, s.address)
+			work[s.address] = new(big.Int)
+		}
+		work[s.address].Add(work[s.address], s.work)
+		total.Add(total, s.work)
+	}
+
+	var payouts []blockchain.Payout
+	remainder := value
+
+	for _, address := range addresses {
+		amount := new(big.Int).Mul(big.NewInt(int64(value)), work[address])
+		amount.Div(amount, total)
+
+		if amount.Sign() > 0 {
+			payouts = append(payouts, blockchain.Payout{Address: address, Value: int(amount.Int64())})
+			remainder -= int(amount.Int64())
+		}
+	}
+
+	if remainder > 0 || len(payouts) == 0 {
+		payouts = append(payouts, blockchain.Payout{Address: poolAddress, Value: remainder})
+	}
+
+	return payouts
+}
@@ -0,0 +1,65 @@
+package pool
+
+import (
+	"golang-blockchain/blockchain"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func TestShareWindowPayouts(t *testing.T) {
+	tests := []struct {
+		name    string
+		shares  []share
+		value   int
+		payouts []blockchain.Payout
+	}{
+		{"no shares yet", nil, 20, []blockchain.Payout{{Address: "pool", Value: 20}}},
+		{
+			"split by work",
+			[]share{{"alice", big.NewInt(1)}, {"bob", big.NewInt(3)}},
+			20,
+			[]blockchain.Payout{{Address: "alice", Value: 5}, {Address: "bob", Value: 15}},
+		},
+		{
+			"remainder to the pool",
+			[]share{{"alice", big.NewInt(1)}, {"bob", big.NewInt(2)}},
+			10,
+			[]blockchain.Payout{{Address: "alice", Value: 3}, {Address: "bob", Value: 6}, {Address: "pool", Value: 1}},
+		},
+		{
+			"only the last shares count",
+			[]share{{"carol", big.NewInt(100)}, {"alice", big.NewInt(1)}, {"bob", big.NewInt(1)}, {"alice", big.NewInt(2)}},
+			20,
+			[]blockchain.Payout{{Address: "alice", Value: 15}, {Address: "bob", Value: 5}},
+		},
+		{
+			"shares too small to earn a token",
+			[]share{{"alice", big.NewInt(1)}, {"bob", big.NewInt(1000)}},
+			10,
+			[]blockchain.Payout{{Address: "bob", Value: 9}, {Address: "pool", Value: 1}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			window := shareWindow{size: 3}
+			for _, s := range test.shares {
+				window.add(s)
+			}
+
+			payouts := window.payouts(test.value, "pool")
+			if !reflect.DeepEqual(payouts, test.payouts) {
+				t.Fatalf("expected payouts %v, got %v", test.payouts, payouts)
+			}
+
+			total := 0
+			for _, payout := range payouts {
+				total += payout.Value
+			}
+			if total != test.value {
+				t.Errorf("payouts add up to %d, expected %d", total, test.value)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package pool
+
+import (
+	"encoding/json"
+	"golang-blockchain/blockchain"
+)
+
+// workers and the pool talk in newline separated JSON messages over TCP, in the style of stratum
+const (
+	methodLogin  = "login"  // worker → pool: Login
+	methodJob    = "job"    // pool → worker: Job, whenever there is new work
+	methodSubmit = "submit" // worker → pool: Share
+	methodResult = "result" // pool → worker: ShareResult
+)
+
+type Message struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+// a worker introducing itself, with the address its share of the rewards gets paid to
+type Login struct {
+	Address string `json:"address"`
+	Worker  string `json:"worker"`
+}
+
+// a unit of work: a block header to find nonces for
+// every worker gets a header of its own, as the pool builds a coinbase for each of them
+type Job struct {
+	ID          string                 `json:"id"`
+	Engine      string                 `json:"engine"` // which hash the header is mined with
+	Header      blockchain.BlockHeader `json:"header"`
+	ShareTarget string                 `json:"shareTarget"` // hex encoded target a share's hash must meet
+}
+
+// a header of the job meeting the share target
+type Share struct {
+	JobID     string `json:"jobId"`
+	Nonce     uint64 `json:"nonce"`
+	Timestamp int64  `json:"timestamp"` // miners roll the timestamp once they run out of nonces
+}
+
+// what the pool made of a share
+type ShareResult struct {
+	JobID    string `json:"jobId"`
+	Nonce    uint64 `json:"nonce"`
+	Accepted bool   `json:"accepted"`
+	Block    bool   `json:"block"`            // whether the share met the network's target too, and was accepted as a block
+	Reason   string `json:"reason,omitempty"` // why the share was rejected
+}
+
+func encodeMessage(method string, params any) (Message, error) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return Message{}, err
+	}
+
+	return Message{method, data}, nil
+}
@@ -8,16 +8,14 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"golang-blockchain/params"
 	"log"
 	"math/big"
 
 	"golang.org/x/crypto/ripemd160"
 )
 
-const (
-	checksumLength = 4
-	version        = byte(0x00)
-)
+const checksumLength = 4
 
 type Wallet struct {
 	PrivateKey ecdsa.PrivateKey
@@ -85,14 +83,36 @@ func (w *Wallet) UnmarshalJSON(data []byte) error {
 func (w Wallet) Address() []byte {
 	publicKeyHashed := PublicKeyHash(w.PublicKey)
 
-	versionedHash := append([]byte{version}, publicKeyHashed...)
+	return KeyHashAddress(publicKeyHashed)
+}
+
+// the address of a public key hash, for keys whose wallet we don't hold
+func KeyHashAddress(publicKeyHash []byte) []byte {
+	// the version byte ties the address to the active network
+	return encodeAddress(params.Active.AddressVersion, publicKeyHash)
+}
+
+// the address of a script, pay-to-script-hash: tokens sent to it can be spent by whoever reveals
+// the script and meets its conditions, which is how multisig addresses are made
+// its own version byte tells it apart from the address of a key
+func ScriptAddress(script []byte) []byte {
+	return encodeAddress(params.Active.ScriptAddressVersion, PublicKeyHash(script))
+}
+
+// whether the address is the address of a script rather than a key
+func IsScriptAddress(address string) bool {
+	fullHash := Base58Decode([]byte(address))
+
+	return ValidateAddress(address) && fullHash[0] == params.Active.ScriptAddressVersion
+}
+
+func encodeAddress(version byte, hash []byte) []byte {
+	versionedHash := append([]byte{version}, hash...)
 	checksum := generateChecksum(versionedHash)
 
 	fullHash := append(versionedHash, checksum...)
 
-	address := Base58Encode(fullHash)
-
-	return address
+	return Base58Encode(fullHash)
 }
 
 // Address: 1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa
@@ -108,9 +128,13 @@ func (w Wallet) Address() []byte {
 // 2. Extracting the version byte and actual checksum
 // 3. Generating a checksum from the version and public key hash
 // 4. Comparing the actual and generated checksums
+// 5. Checking the version byte belongs to the active network, either for a key or a script
 func ValidateAddress(address string) bool {
 	// decode the Base58 address back into the full hash
 	publicKeyHash := Base58Decode([]byte(address))
+	if len(publicKeyHash) <= 1+checksumLength {
+		return false
+	}
 
 	// extract the actual checksum (last 4 bytes)
 	actualChecksum := publicKeyHash[len(publicKeyHash)-checksumLength:]
@@ -125,7 +149,12 @@ func ValidateAddress(address string) bool {
 	targetChecksum := generateChecksum(append([]byte{version}, publicKeyHash...))
 
 	// compare the actual and generated checksums
-	return bytes.Compare(actualChecksum, targetChecksum) == 0
+	if bytes.Compare(actualChecksum, targetChecksum) != 0 {
+		return false
+	}
+
+	// addresses of other networks are well formed, but can't be used on this one
+	return version == params.Active.AddressVersion || version == params.Active.ScriptAddressVersion
 }
 
 func newKeyPair() (ecdsa.PrivateKey, []byte) {
@@ -137,7 +166,8 @@ func newKeyPair() (ecdsa.PrivateKey, []byte) {
 	}
 
 	// concatenate X and Y coordinates to form the public key
-	publicKey := append(privateKey.PublicKey.X.Bytes(), privateKey.PublicKey.Y.Bytes()...)
+	// both are padded to 32 bytes so the key can be split back in half
+	publicKey := append(privateKey.PublicKey.X.FillBytes(make([]byte, 32)), privateKey.PublicKey.Y.FillBytes(make([]byte, 32))...)
 
 	return *privateKey, publicKey
 }
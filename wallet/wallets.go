@@ -1,6 +1,7 @@
 package wallet
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -11,11 +12,15 @@ const walletFile = "./tmp/wallets_%s.data"
 
 type Wallets struct {
 	Wallets map[string]*Wallet `json:"wallets"`
+
+	// the hex encoded multisig scripts the wallet keeps track of, by their address
+	Multisigs map[string]string `json:"multisigs,omitempty"`
 }
 
 func CreateWallets(nodeId string) (*Wallets, error) {
 	wallets := Wallets{}
 	wallets.Wallets = make(map[string]*Wallet)
+	wallets.Multisigs = make(map[string]string)
 
 	err := wallets.loadFile(nodeId)
 	return &wallets, err
@@ -44,6 +49,30 @@ func (wallets *Wallets) GetWallet(address string) Wallet {
 	return *wallets.Wallets[address]
 }
 
+// keep track of a multisig script, returning its address
+func (wallets *Wallets) AddMultisig(script []byte) string {
+	address := fmt.Sprintf("%s", ScriptAddress(script))
+
+	wallets.Multisigs[address] = hex.EncodeToString(script)
+
+	return address
+}
+
+// the multisig script behind the address, if the wallet keeps track of it
+func (wallets *Wallets) GetMultisig(address string) ([]byte, bool) {
+	script, ok := wallets.Multisigs[address]
+	if !ok {
+		return nil, false
+	}
+
+	data, err := hex.DecodeString(script)
+	if err != nil {
+		return nil, false
+	}
+
+	return data, true
+}
+
 func (wallets *Wallets) loadFile(nodeId string) error {
 	walletFile := fmt.Sprintf(walletFile, nodeId)
 
@@ -63,6 +92,9 @@ func (wallets *Wallets) loadFile(nodeId string) error {
 	}
 
 	wallets.Wallets = ws.Wallets
+	if ws.Multisigs != nil {
+		wallets.Multisigs = ws.Multisigs
+	}
 	return nil
 }
 